@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/viper"
+)
+
+// --ask-pass modes: one password for every host, or one per user@host:port.
+const (
+	askPassOnce    = "once"
+	askPassPerHost = "per-host"
+)
+
+// errNoPrompt is returned by readPassword when there is neither a terminal nor
+// an askpass program to ask, as under cron or CI.
+var errNoPrompt = errors.New("reading a password needs a terminal or SSH_ASKPASS")
+
+// readPasswordFunc prompts for a password without echo. It is a package
+// variable so tests can answer prompts without a terminal.
+var readPasswordFunc = readPassword
+
+// unlockIdentityFilesFunc decrypts passphrase-protected identity files. It is
+// a package variable so tests can check which files are asked for.
+var unlockIdentityFilesFunc = sshConn.UnlockIdentityFiles
+
+// readPassword prompts on stderr and reads from the terminal, which is opened
+// directly when stdin carries a hosts list. Like OpenSSH, an askpass program
+// answers instead when SSH_ASKPASS_REQUIRE is force or prefer, or when there
+// is no terminal, unless SSH_ASKPASS_REQUIRE is never.
+func readPassword(prompt string) (string, error) {
+	program := askpassProgram()
+	require := os.Getenv("SSH_ASKPASS_REQUIRE")
+	if program != "" && (require == "force" || require == "prefer") {
+		return runAskpass(program, prompt)
+	}
+	in := os.Stdin
+	if !term.IsTerminal(in.Fd()) {
+		tty, err := os.OpenFile(ttyPath(), os.O_RDWR, 0)
+		if err != nil {
+			if program != "" && require != "never" {
+				return runAskpass(program, prompt)
+			}
+			return "", fmt.Errorf("%w: %v", errNoPrompt, err)
+		}
+		defer tty.Close()
+		in = tty
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(in.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("unable to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// askpassProgram is the askpass config key, falling back to SSH_ASKPASS.
+func askpassProgram() string {
+	if program := strings.TrimSpace(viper.GetString("askpass")); program != "" {
+		return program
+	}
+	return os.Getenv("SSH_ASKPASS")
+}
+
+// runAskpass runs program with prompt as its argument and returns the first
+// line it prints.
+func runAskpass(program, prompt string) (string, error) {
+	c := exec.Command(program, prompt)
+	c.Stderr = os.Stderr
+	output, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("askpass %q failed: %w", program, err)
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// unlockIdentities asks for the passphrases of the encrypted identity files
+// hosts and their jump hosts use, before the shell takes over the terminal.
+// Each file is asked for once and its key is reused by every host. Without a
+// way to prompt, encrypted keys are skipped and left to the agent, so
+// unattended runs keep working as they did before keys could be unlocked.
+func unlockIdentities(hostList *sshConn.HostList) error {
+	var paths []string
+	for _, host := range hostList.Hosts() {
+		for _, jump := range host.ProxyJump {
+			paths = append(paths, jump.IdentityFiles...)
+		}
+		paths = append(paths, host.IdentityFiles...)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return unlockIdentityFilesFunc(paths, func(path string) ([]byte, error) {
+		passphrase, err := readPasswordFunc(fmt.Sprintf("Enter passphrase for key '%s': ", path))
+		if errors.Is(err, errNoPrompt) {
+			return nil, nil
+		}
+		return []byte(passphrase), err
+	})
+}
+
+// promptMu serializes keyboard-interactive prompts of hosts connecting at once.
+var promptMu sync.Mutex
+
+// promptKeyboardInteractive asks the user a keyboard-interactive question of
+// hostname, such as an OTP verification code. It backs
+// sshConn.KeyboardInteractivePrompt for `exec`, which owns the terminal while
+// it connects; without a way to prompt the answer is left empty.
+func promptKeyboardInteractive(hostname, question string, echo bool) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	answer, err := readPasswordFunc(fmt.Sprintf("(%s) %s", hostname, question))
+	if errors.Is(err, errNoPrompt) {
+		return "", nil
+	}
+	return answer, err
+}
+
+// askPasswords prompts for the password hosts and their jump hosts answer
+// password and keyboard-interactive authentication with, before the shell
+// takes over the terminal. Hosts whose SSH config disables both methods are
+// never prompted for.
+func askPasswords(hostList *sshConn.HostList, mode string) error {
+	switch mode {
+	case "":
+		return nil
+	case askPassOnce, askPassPerHost:
+	default:
+		return fmt.Errorf("invalid ask-pass %q: must be %s or %s", mode, askPassOnce, askPassPerHost)
+	}
+
+	passwords := make(map[string]string)
+	ask := func(user, host string, port int) (string, error) {
+		key := user + "@" + net.JoinHostPort(host, strconv.Itoa(port))
+		prompt := key + "'s password: "
+		if mode == askPassOnce {
+			key, prompt = "", "SSH password: "
+		}
+		if password, ok := passwords[key]; ok {
+			return password, nil
+		}
+		password, err := readPasswordFunc(prompt)
+		if err != nil {
+			return "", err
+		}
+		passwords[key] = password
+		return password, nil
+	}
+
+	for _, host := range hostList.Hosts() {
+		for i := range host.ProxyJump {
+			jump := &host.ProxyJump[i]
+			if !jump.PasswordAuthentication && !jump.KbdInteractiveAuthentication {
+				continue
+			}
+			password, err := ask(jump.User, jump.Host, jump.Port)
+			if err != nil {
+				return err
+			}
+			jump.Password = password
+		}
+		if !host.PasswordAuth && !host.KbdInteractiveAuth {
+			continue
+		}
+		password, err := ask(host.User, host.Host, host.Port)
+		if err != nil {
+			return err
+		}
+		host.Password = password
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func stubReadPassword(t *testing.T, answers map[string]string) *[]string {
+	t.Helper()
+	prev := readPasswordFunc
+	t.Cleanup(func() { readPasswordFunc = prev })
+	var prompts []string
+	readPasswordFunc = func(prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		answer, ok := answers[prompt]
+		if !ok {
+			t.Fatalf("unexpected prompt %q", prompt)
+		}
+		return answer, nil
+	}
+	return &prompts
+}
+
+func passwordHostList() *sshConn.HostList {
+	bastion := sshConn.ResolvedHost{Host: "bastion", Port: 22, User: "ops", PasswordAuthentication: true, KbdInteractiveAuthentication: true}
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Host: "web1", Port: 22, User: "deploy", PasswordAuth: true, KbdInteractiveAuth: true, ProxyJump: []sshConn.ResolvedHost{bastion}})
+	hostList.AddHost(&sshConn.Host{Host: "web2", Port: 2222, User: "deploy", KbdInteractiveAuth: true, ProxyJump: []sshConn.ResolvedHost{bastion}})
+	hostList.AddHost(&sshConn.Host{Host: "db1", Port: 22, User: "postgres"})
+	return hostList
+}
+
+func hostPasswords(hostList *sshConn.HostList) []string {
+	passwords := make([]string, 0, hostList.Len()*2)
+	for _, host := range hostList.Hosts() {
+		for _, jump := range host.ProxyJump {
+			passwords = append(passwords, jump.Password)
+		}
+		passwords = append(passwords, host.Password)
+	}
+	return passwords
+}
+
+func TestAskPasswordsOnce(t *testing.T) {
+	prompts := stubReadPassword(t, map[string]string{"SSH password: ": "s3cret"})
+	hostList := passwordHostList()
+	if err := askPasswords(hostList, askPassOnce); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*prompts) != 1 {
+		t.Fatalf("expected a single prompt, got %v", *prompts)
+	}
+	want := []string{"s3cret", "s3cret", "s3cret", "s3cret", ""}
+	if got := hostPasswords(hostList); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected passwords: %v", got)
+	}
+}
+
+func TestAskPasswordsPerHost(t *testing.T) {
+	prompts := stubReadPassword(t, map[string]string{
+		"ops@bastion:22's password: ":   "jump",
+		"deploy@web1:22's password: ":   "one",
+		"deploy@web2:2222's password: ": "two",
+	})
+	hostList := passwordHostList()
+	if err := askPasswords(hostList, askPassPerHost); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantPrompts := []string{"ops@bastion:22's password: ", "deploy@web1:22's password: ", "deploy@web2:2222's password: "}
+	if !reflect.DeepEqual(*prompts, wantPrompts) {
+		t.Fatalf("unexpected prompts: %v", *prompts)
+	}
+	want := []string{"jump", "one", "jump", "two", ""}
+	if got := hostPasswords(hostList); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected passwords: %v", got)
+	}
+}
+
+func TestAskPasswordsModes(t *testing.T) {
+	stubReadPassword(t, nil)
+	hostList := passwordHostList()
+	if err := askPasswords(hostList, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := askPasswords(hostList, "always"); err == nil || err.Error() != `invalid ask-pass "always": must be once or per-host` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUnlockIdentitiesAsksForHostAndJumpKeys(t *testing.T) {
+	prevUnlock := unlockIdentityFilesFunc
+	t.Cleanup(func() { unlockIdentityFilesFunc = prevUnlock })
+	var gotPaths []string
+	var gotPassphrase string
+	unlockIdentityFilesFunc = func(paths []string, passphrase func(string) ([]byte, error)) error {
+		gotPaths = paths
+		secret, err := passphrase(paths[0])
+		gotPassphrase = string(secret)
+		return err
+	}
+	prompts := stubReadPassword(t, map[string]string{"Enter passphrase for key '~/.ssh/bastion': ": "secret"})
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{
+		Host:          "web1",
+		IdentityFiles: []string{"~/.ssh/web"},
+		ProxyJump:     []sshConn.ResolvedHost{{Host: "bastion", IdentityFiles: []string{"~/.ssh/bastion"}}},
+	})
+	hostList.AddHost(&sshConn.Host{Host: "web2", IdentityFiles: []string{"~/.ssh/web"}})
+	if err := unlockIdentities(hostList); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"~/.ssh/bastion", "~/.ssh/web", "~/.ssh/web"}; !reflect.DeepEqual(gotPaths, want) {
+		t.Fatalf("unexpected paths: %v", gotPaths)
+	}
+	if gotPassphrase != "secret" || len(*prompts) != 1 {
+		t.Fatalf("unexpected passphrase %q after prompts %v", gotPassphrase, *prompts)
+	}
+}
+
+func TestUnlockIdentitiesSkipsKeysWithoutPrompt(t *testing.T) {
+	prevUnlock := unlockIdentityFilesFunc
+	prevRead := readPasswordFunc
+	t.Cleanup(func() {
+		unlockIdentityFilesFunc = prevUnlock
+		readPasswordFunc = prevRead
+	})
+	readPasswordFunc = func(prompt string) (string, error) {
+		return "", fmt.Errorf("%w: open /dev/tty: no such device or address", errNoPrompt)
+	}
+	var secret []byte
+	var passphraseErr error
+	unlockIdentityFilesFunc = func(paths []string, passphrase func(string) ([]byte, error)) error {
+		secret, passphraseErr = passphrase(paths[0])
+		return passphraseErr
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Host: "web1", IdentityFiles: []string{"~/.ssh/id_ed25519"}})
+	if err := unlockIdentities(hostList); err != nil {
+		t.Fatalf("expected the key to be skipped, got %v", err)
+	}
+	if len(secret) != 0 || passphraseErr != nil {
+		t.Fatalf("expected an empty passphrase, got %q, %v", secret, passphraseErr)
+	}
+
+	readPasswordFunc = func(prompt string) (string, error) {
+		return "", errors.New("askpass \"ask\" failed: exit status 1")
+	}
+	if err := unlockIdentities(hostList); err == nil {
+		t.Fatal("expected other prompt errors to be reported")
+	}
+}
+
+func TestPromptKeyboardInteractive(t *testing.T) {
+	prompts := stubReadPassword(t, map[string]string{"(web1:22) Verification code: ": "123456"})
+	answer, err := promptKeyboardInteractive("web1:22", "Verification code: ", false)
+	if err != nil || answer != "123456" {
+		t.Fatalf("unexpected answer %q, %v", answer, err)
+	}
+	if len(*prompts) != 1 {
+		t.Fatalf("unexpected prompts: %v", *prompts)
+	}
+
+	readPasswordFunc = func(prompt string) (string, error) {
+		return "", fmt.Errorf("%w: no tty", errNoPrompt)
+	}
+	if answer, err := promptKeyboardInteractive("web1:22", "Verification code: ", false); err != nil || answer != "" {
+		t.Fatalf("expected an empty answer without a terminal, got %q, %v", answer, err)
+	}
+}
+
+func TestRunAskpass(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX shell not available on Windows CI images")
+	}
+	program := filepath.Join(t.TempDir(), "askpass")
+	if err := os.WriteFile(program, []byte("#!/bin/sh\nprintf 'pw for %s\\nignored\\n' \"$1\"\n"), 0o755); err != nil {
+		t.Fatalf("write askpass: %v", err)
+	}
+	answer, err := runAskpass(program, "key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer != "pw for key" {
+		t.Fatalf("unexpected answer: %q", answer)
+	}
+
+	if _, err := runAskpass("/bin/false", "key"); err == nil {
+		t.Fatal("expected a failing askpass to be an error")
+	}
+}
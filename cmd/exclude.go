@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// hostMatcher reports whether a host spec matches an exclusion pattern.
+type hostMatcher func(HostSpec) bool
+
+// parseHostMatcher compiles an exclusion pattern. /regex/ is matched against
+// host:port and the bare host, a pattern containing * or ? is a glob matched
+// the same way, and anything else is a host spec, ranges included, matching
+// hosts with the same name and, when given, the same port and user.
+func parseHostMatcher(pattern string) (hostMatcher, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return nil, fmt.Errorf("exclude pattern is empty")
+	}
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude regex %q: %v", pattern, err)
+		}
+		return func(spec HostSpec) bool {
+			return re.MatchString(hostDisplayName(spec)) || re.MatchString(spec.Host)
+		}, nil
+	}
+	if strings.ContainsAny(pattern, "*?") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude glob %q: %v", pattern, err)
+		}
+		return func(spec HostSpec) bool {
+			for _, name := range []string{hostDisplayName(spec), spec.Host} {
+				if ok, _ := path.Match(pattern, name); ok {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	excluded, err := parseHostSpecs(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+	}
+	return func(spec HostSpec) bool {
+		for _, ex := range excluded {
+			if ex.Host == spec.Host && (!ex.PortSet || ex.Port == spec.Port) && (!ex.UserSet || ex.User == spec.User) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseExcludeEntry returns the spec for a "!pattern" entry of a hosts file or
+// group list, or false when entry is a regular host.
+func parseExcludeEntry(entry string) (HostSpec, bool, error) {
+	pattern, ok := strings.CutPrefix(strings.TrimSpace(entry), "!")
+	if !ok {
+		return HostSpec{}, false, nil
+	}
+	if _, err := parseHostMatcher(pattern); err != nil {
+		return HostSpec{}, true, err
+	}
+	return HostSpec{Exclude: strings.TrimSpace(pattern)}, true, nil
+}
+
+// splitExcludeFlag splits an --exclude value on the commas that are not part
+// of a range or brace group. A /regex/ value is never split.
+func splitExcludeFlag(value string) []string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		return []string{value}
+	}
+	parts := make([]string, 0)
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// excludeHosts drops the hosts matched by the "!pattern" entries of specs and
+// by patterns, and removes the exclusion entries themselves.
+func excludeHosts(specs []HostSpec, patterns []string) ([]HostSpec, error) {
+	matchers := make([]hostMatcher, 0, len(patterns))
+	for _, value := range patterns {
+		for _, pattern := range splitExcludeFlag(value) {
+			matcher, err := parseHostMatcher(pattern)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	kept, err := dropExcluded(specs, matchers)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) == 0 {
+		for _, spec := range specs {
+			if spec.Exclude == "" {
+				return nil, fmt.Errorf("every host was excluded")
+			}
+		}
+	}
+	return kept, nil
+}
+
+// dropExcluded removes the "!pattern" entries of specs along with the hosts
+// matched by them or by matchers.
+func dropExcluded(specs []HostSpec, matchers []hostMatcher) ([]HostSpec, error) {
+	for _, spec := range specs {
+		if spec.Exclude == "" {
+			continue
+		}
+		matcher, err := parseHostMatcher(spec.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	kept := make([]HostSpec, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Exclude != "" {
+			continue
+		}
+		excluded := false
+		for _, matcher := range matchers {
+			if matcher(spec) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, spec)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func hostNames(specs []HostSpec) []string {
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, hostDisplayName(spec))
+	}
+	return names
+}
+
+func TestExcludeHostsPatterns(t *testing.T) {
+	specs, err := parseArgsHosts([]string{"web[1-3]", "db1:2222", "deploy@cache1", "canary1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"canary1"}, []string{"web1:22", "web2:22", "web3:22", "db1:2222", "cache1:22"}},
+		{[]string{"web*"}, []string{"db1:2222", "cache1:22", "canary1:22"}},
+		{[]string{"/^(web|db)/"}, []string{"cache1:22", "canary1:22"}},
+		{[]string{"web[1-2],canary1"}, []string{"web3:22", "db1:2222", "cache1:22"}},
+		{[]string{"web{1,3}", "*:2222"}, []string{"web2:22", "cache1:22", "canary1:22"}},
+		{[]string{"db1:22"}, []string{"web1:22", "web2:22", "web3:22", "db1:2222", "cache1:22", "canary1:22"}},
+		{[]string{"root@cache1"}, []string{"web1:22", "web2:22", "web3:22", "db1:2222", "cache1:22", "canary1:22"}},
+		{[]string{"deploy@cache1"}, []string{"web1:22", "web2:22", "web3:22", "db1:2222", "canary1:22"}},
+	}
+	for _, tc := range tests {
+		got, err := excludeHosts(specs, tc.patterns)
+		if err != nil {
+			t.Fatalf("excludeHosts(%v): unexpected error: %v", tc.patterns, err)
+		}
+		if names := hostNames(got); !reflect.DeepEqual(names, tc.want) {
+			t.Fatalf("excludeHosts(%v) = %v", tc.patterns, names)
+		}
+	}
+}
+
+func TestExcludeHostsErrors(t *testing.T) {
+	specs, err := parseArgsHosts([]string{"web1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := excludeHosts(specs, []string{"/(/"}); err == nil || !strings.Contains(err.Error(), "invalid exclude regex") {
+		t.Fatalf("expected regex error, got %v", err)
+	}
+	if _, err := excludeHosts(specs, []string{"web[2-1]"}); err == nil || !strings.Contains(err.Error(), "invalid exclude pattern") {
+		t.Fatalf("expected pattern error, got %v", err)
+	}
+	if _, err := excludeHosts(specs, []string{"web1"}); err == nil || err.Error() != "every host was excluded" {
+		t.Fatalf("expected every host excluded error, got %v", err)
+	}
+}
+
+func TestParseHostsFileExcludeEntries(t *testing.T) {
+	specs, err := parseHostsFile([]byte("web[1-3]\n!web2\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(specs) != 4 || specs[3].Exclude != "web2" {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+	kept, err := excludeHosts(specs, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := hostNames(kept); !reflect.DeepEqual(names, []string{"web1:22", "web3:22"}) {
+		t.Fatalf("unexpected hosts: %v", names)
+	}
+
+	if _, err := parseHostsFile([]byte("web1\n!/(/\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected error on line 2, got %v", err)
+	}
+}
+
+func TestParseGroupSpecsExcludeEntries(t *testing.T) {
+	raw := map[string]interface{}{
+		"user":  "deploy",
+		"hosts": []interface{}{"web[1-2]", "!web1"},
+	}
+	specs, err := parseGroupSpecs(raw, "web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "web1", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"web"}},
+		{Host: "web2", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"web"}},
+		{Exclude: "web1"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+}
+
+func TestLoadHostListAppliesExcludeFlag(t *testing.T) {
+	prevExclude := excludePatterns
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		excludePatterns = prevExclude
+		loadSSHConfigFunc = prevLoad
+	})
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	excludePatterns = []string{"web2"}
+
+	hostList, err := loadHostList([]string{"web1", "web2", "web3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := make([]string, 0, hostList.Len())
+	for _, host := range hostList.Hosts() {
+		names = append(names, host.Hostname)
+	}
+	if !reflect.DeepEqual(names, []string{"web1:22", "web3:22"}) {
+		t.Fatalf("unexpected hosts: %v", names)
+	}
+}
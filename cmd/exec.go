@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/ncode/pretty/internal/shell"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/cobra"
+)
+
+var execShellFunc = shell.Exec
+
+var execOptions shell.ExecOptions
+
+// ExecCmd runs a single command on every host and exits, for use from cron,
+// CI or Makefiles where the interactive shell is not available.
+var ExecCmd = &cobra.Command{
+	Use:   "exec [hosts...] -- <command>",
+	Short: "Run one command on every host and exit",
+	Long: `Run one command on every host and exit
+
+Output is prefixed with the host name, and a per-host summary is printed once
+every host has finished. The exit status is non-zero when any host fails.
+
+usage:
+	pretty exec -G prod -- 'uptime'
+	pretty exec host1 host2 -- 'uptime'
+	pretty -H hosts.txt exec uptime
+	pretty exec -G prod --batch 5 --max-fail 2 -- './deploy.sh'
+`,
+	// main reports the returned error; cobra printing it too would show every
+	// failure twice.
+	SilenceErrors: true,
+	Args: func(cmd *cobra.Command, args []string) error {
+		hosts, command := splitExecArgs(cmd, args)
+		if len(hosts) < 1 && hostGroup == "" && hostsFile == "" && inventoryFile == "" && hostsCommand == "" {
+			return errors.New("requires at least one host, hostGroup, hostsFile, inventory or hosts-cmd")
+		}
+		if command == "" {
+			return errors.New("requires a command to run")
+		}
+		// Without --batch every host runs in a single wave, so there is no
+		// later wave for --max-fail to skip.
+		if cmd.Flags().Changed("max-fail") && execOptions.Rolling.Batch <= 0 {
+			return errors.New("--max-fail requires --batch")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hosts, command := splitExecArgs(cmd, args)
+		hostList, err := loadHostList(hosts)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		// Unlike the interactive shell, exec leaves the terminal free while
+		// hosts connect, so OTP and similar questions can be asked.
+		sshConn.KeyboardInteractivePrompt = promptKeyboardInteractive
+		return execShellFunc(hostList, command, execOptions, os.Stdout, os.Stderr)
+	},
+}
+
+// splitExecArgs separates host args from the command. Everything after `--` is
+// the command; without `--` all args are the command and hosts must come from
+// --hostGroup or --hostsFile.
+func splitExecArgs(cmd *cobra.Command, args []string) ([]string, string) {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 {
+		return nil, strings.TrimSpace(strings.Join(args, " "))
+	}
+	return args[:dash], strings.TrimSpace(strings.Join(args[dash:], " "))
+}
+
+func init() {
+	ExecCmd.Flags().IntVar(&execOptions.Rolling.Batch, "batch", 0, "run on this many hosts at a time, waiting for each batch to finish (0 runs all hosts at once)")
+	ExecCmd.Flags().IntVar(&execOptions.Rolling.MaxFail, "max-fail", 1, "with --batch, skip the remaining hosts once this many have failed (0 never stops)")
+	ExecCmd.Flags().BoolVar(&execOptions.Collapse, "collapse", false, "print each distinct output once under a compressed host list instead of streaming stdout")
+	ExecCmd.Flags().StringSliceVar(&execOptions.Streams, "stream", nil, "print only these streams: stdout, stderr, system or all (default all)")
+	ExecCmd.Flags().StringVar(&execOptions.Output, "output", shell.OutputText, "output format: text or json (NDJSON, one record per line plus one result per host)")
+	RootCmd.AddCommand(ExecCmd)
+}
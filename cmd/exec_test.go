@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncode/pretty/internal/shell"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func TestExecRunsCommandOnHostsAfterDash(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	prevExec := execShellFunc
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		execShellFunc = prevExec
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	var gotHosts []string
+	var gotCommand string
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		for _, host := range hostList.Hosts() {
+			gotHosts = append(gotHosts, host.Hostname)
+		}
+		gotCommand = command
+		return nil
+	}
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "host1", "host2:2222", "--", "uptime", "-p"})
+
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(gotHosts) != 2 || gotHosts[0] != "host1:22" || gotHosts[1] != "host2:2222" {
+		t.Fatalf("unexpected hosts: %#v", gotHosts)
+	}
+	if gotCommand != "uptime -p" {
+		t.Fatalf("unexpected command: %q", gotCommand)
+	}
+}
+
+func TestExecReturnsErrorWhenHostsFail(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	prevExec := execShellFunc
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		execShellFunc = prevExec
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		return errors.New("command failed on 1 of 1 hosts")
+	}
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "host1", "--", "false"})
+
+	err := Execute()
+	if err == nil || !strings.Contains(err.Error(), "command failed") {
+		t.Fatalf("expected host failure error, got %v", err)
+	}
+}
+
+func TestExecRequiresCommand(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		RootCmd.SetArgs(nil)
+	})
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "host1", "--"})
+
+	err := Execute()
+	if err == nil || !strings.Contains(err.Error(), "requires a command") {
+		t.Fatalf("expected missing command error, got %v", err)
+	}
+}
+
+func TestExecRequiresHosts(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		RootCmd.SetArgs(nil)
+	})
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "--", "uptime"})
+
+	err := Execute()
+	if err == nil || !strings.Contains(err.Error(), "requires at least one host") {
+		t.Fatalf("expected missing hosts error, got %v", err)
+	}
+}
+
+func TestExecPassesRollingFlags(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	prevExec := execShellFunc
+	prevOptions := execOptions
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		execShellFunc = prevExec
+		execOptions = prevOptions
+		ExecCmd.Flags().Lookup("max-fail").Changed = false
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	var got shell.ExecOptions
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		got = options
+		return nil
+	}
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "--batch", "5", "--max-fail", "2", "host1", "--", "./deploy.sh"})
+
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Rolling.Batch != 5 || got.Rolling.MaxFail != 2 {
+		t.Fatalf("unexpected options: %+v", got)
+	}
+}
+
+func TestExecMaxFailDefaultsAndRequiresBatch(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	prevExec := execShellFunc
+	prevOptions := execOptions
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		execShellFunc = prevExec
+		execOptions = prevOptions
+		ExecCmd.Flags().Lookup("max-fail").Changed = false
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	var got shell.ExecOptions
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		got = options
+		return nil
+	}
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"exec", "--batch", "5", "host1", "--", "./deploy.sh"})
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Rolling.Batch != 5 || got.Rolling.MaxFail != 1 {
+		t.Fatalf("expected --max-fail to default to 1 like :rolling, got %+v", got)
+	}
+
+	execOptions = prevOptions
+	RootCmd.SetArgs([]string{"exec", "--max-fail", "2", "host1", "--", "./deploy.sh"})
+	if err := Execute(); err == nil || err.Error() != "--max-fail requires --batch" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestExecJSONOutputKeepsStdoutParseable(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevCfgFile := cfgFile
+	prevOptions := execOptions
+	prevLoad := loadSSHConfigFunc
+	prevExec := execShellFunc
+	prevStdout := os.Stdout
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		cfgFile = prevCfgFile
+		execOptions = prevOptions
+		loadSSHConfigFunc = prevLoad
+		execShellFunc = prevExec
+		os.Stdout = prevStdout
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		_, _ = io.WriteString(stdout, `{"type":"result","host":"host1:22","exit_code":1}`+"\n")
+		return errors.New("command failed on 1 of 1 hosts")
+	}
+	config := filepath.Join(t.TempDir(), "pretty.yaml")
+	if err := os.WriteFile(config, []byte("# no settings\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	os.Stdout = w
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"--config", config, "exec", "--output", "json", "host1", "--", "false"})
+	if err := Execute(); err == nil {
+		t.Fatal("expected host failure error")
+	}
+	w.Close()
+	os.Stdout = prevStdout
+
+	lines := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines++
+		if !json.Valid(scanner.Bytes()) {
+			t.Fatalf("stdout line is not JSON: %q", scanner.Text())
+		}
+	}
+	if lines != 1 {
+		t.Fatalf("expected one JSON line on stdout, got %d", lines)
+	}
+}
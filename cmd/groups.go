@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// groupLookup returns the config of a host group, or nil when there is none.
+type groupLookup func(name string) interface{}
+
+func configGroup(name string) interface{} {
+	return viper.Get(fmt.Sprintf("groups.%s", name))
+}
+
+// resolveGroupExpr resolves a --hostGroup expression. `,` and `+` take the
+// union of groups and `&`, which binds tighter, their intersection, so
+// prod&web,db is every prod host that is also in web, plus every db host.
+func resolveGroupExpr(expr string, lookup groupLookup) ([]HostSpec, error) {
+	return evalGroupExpr(expr, func(name string) ([]HostSpec, error) {
+		return resolveGroup(name, lookup, nil)
+	})
+}
+
+// evalGroupExpr evaluates a group expression, resolving each group name with
+// resolve.
+func evalGroupExpr(expr string, resolve func(name string) ([]HostSpec, error)) ([]HostSpec, error) {
+	terms := make([][]string, 0)
+	for _, term := range strings.Split(strings.ReplaceAll(expr, "+", ","), ",") {
+		names := strings.Split(term, "&")
+		for i, name := range names {
+			names[i] = strings.TrimSpace(name)
+			if names[i] == "" {
+				return nil, fmt.Errorf("invalid host group expression %q", expr)
+			}
+		}
+		terms = append(terms, names)
+	}
+
+	var result []HostSpec
+	for _, names := range terms {
+		var termSpecs []HostSpec
+		for i, name := range names {
+			specs, err := resolve(name)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				termSpecs = specs
+			} else {
+				termSpecs = intersectSpecs(termSpecs, specs)
+			}
+		}
+		result = unionSpecs(result, termSpecs)
+	}
+	return result, nil
+}
+
+// resolveGroup returns the hosts of a group followed by those of the groups it
+// includes, minus the group's "!pattern" entries. The group's user, port and
+// connection settings apply to included hosts without their own, and they are
+// tagged with both group names.
+// stack holds the groups being resolved and is used to report cycles.
+func resolveGroup(name string, lookup groupLookup, stack []string) ([]HostSpec, error) {
+	for i, seen := range stack {
+		if seen == name {
+			return nil, fmt.Errorf("host group cycle: %s", strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+	raw := lookup(name)
+	if raw == nil {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("unknown host group %q", name)
+		}
+		return nil, fmt.Errorf("host group %q includes unknown group %q", stack[len(stack)-1], name)
+	}
+	specs, err := parseGroupSpecs(raw, name)
+	if err != nil {
+		return nil, err
+	}
+	value, err := groupObject(raw, name)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := groupIncludes(value, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := parseGroupDefaults(value, name)
+	if err != nil {
+		return nil, err
+	}
+	stack = append(stack[:len(stack):len(stack)], name)
+	for _, include := range includes {
+		included, err := resolveGroup(include, lookup, stack)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range included {
+			defaults.applyTo(&spec)
+			spec.Groups = mergeGroups(spec.Groups, []string{name})
+			specs = append(specs, spec)
+		}
+	}
+	kept, err := dropExcluded(specs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return unionSpecs(nil, kept), nil
+}
+
+func groupIncludes(value map[string]interface{}, groupName string) ([]string, error) {
+	raw, ok := value["include"]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("host group %q include must be a list of group names", groupName)
+	}
+	includes := make([]string, 0, len(list))
+	for i, entry := range list {
+		name, ok := entry.(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("host group %q include entry %d must be a group name", groupName, i+1)
+		}
+		includes = append(includes, strings.TrimSpace(name))
+	}
+	return includes, nil
+}
+
+// unionSpecs appends the hosts of b missing from a. A host present in both
+// keeps its first spec and gains the groups of the other.
+func unionSpecs(a, b []HostSpec) []HostSpec {
+	index := make(map[string]int, len(a)+len(b))
+	for i, spec := range a {
+		index[hostDisplayName(spec)] = i
+	}
+	for _, spec := range b {
+		key := hostDisplayName(spec)
+		if i, ok := index[key]; ok {
+			a[i].Groups = mergeGroups(a[i].Groups, spec.Groups)
+			continue
+		}
+		index[key] = len(a)
+		a = append(a, spec)
+	}
+	return a
+}
+
+// intersectSpecs keeps the hosts of a that are also in b.
+func intersectSpecs(a, b []HostSpec) []HostSpec {
+	inB := make(map[string]HostSpec, len(b))
+	for _, spec := range b {
+		inB[hostDisplayName(spec)] = spec
+	}
+	kept := make([]HostSpec, 0, len(a))
+	for _, spec := range a {
+		other, ok := inB[hostDisplayName(spec)]
+		if !ok {
+			continue
+		}
+		spec.Groups = mergeGroups(spec.Groups, other.Groups)
+		kept = append(kept, spec)
+	}
+	return kept
+}
+
+func mergeGroups(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, group := range b {
+		found := false
+		for _, existing := range merged {
+			if existing == group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, group)
+		}
+	}
+	return merged
+}
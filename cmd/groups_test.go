@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func groupsFromYAML(t *testing.T, config string) groupLookup {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	return func(name string) interface{} {
+		return v.Get("groups." + name)
+	}
+}
+
+const fleetConfig = `
+groups:
+  web:
+    hosts:
+      - web[1-2]
+  db:
+    user: postgres
+    hosts:
+      - db1
+  canary:
+    hosts:
+      - web2
+  prod:
+    user: deploy
+    include: [web, db]
+    hosts:
+      - cache1
+      - "!web1"
+  staging:
+    hosts:
+      - web2
+      - stage1
+`
+
+func TestResolveGroupIncludes(t *testing.T) {
+	specs, err := resolveGroupExpr("prod", groupsFromYAML(t, fleetConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "cache1", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"prod"}},
+		{Host: "web2", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"web", "prod"}},
+		{Host: "db1", Port: defaultPort, User: "postgres", UserSet: true, Groups: []string{"db", "prod"}},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+}
+
+func TestResolveGroupExprSetOperations(t *testing.T) {
+	lookup := groupsFromYAML(t, fleetConfig)
+	tests := map[string][]string{
+		"web,db":           {"web1:22", "web2:22", "db1:22"},
+		"web+staging":      {"web1:22", "web2:22", "stage1:22"},
+		"prod&web":         {"web2:22"},
+		"staging&web,db":   {"web2:22", "db1:22"},
+		"prod&staging&web": {"web2:22"},
+		" web , canary ":   {"web1:22", "web2:22"},
+		"staging&db":       {},
+	}
+	for expr, want := range tests {
+		specs, err := resolveGroupExpr(expr, lookup)
+		if err != nil {
+			t.Fatalf("resolveGroupExpr(%q): unexpected error: %v", expr, err)
+		}
+		if names := hostNames(specs); !reflect.DeepEqual(names, want) {
+			t.Fatalf("resolveGroupExpr(%q) = %v, want %v", expr, names, want)
+		}
+	}
+
+	specs, err := resolveGroupExpr("web,canary", lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(specs[1].Groups, []string{"web", "canary"}) {
+		t.Fatalf("expected merged groups, got %v", specs[1].Groups)
+	}
+}
+
+func TestResolveGroupExprErrors(t *testing.T) {
+	lookup := groupsFromYAML(t, `
+groups:
+  a:
+    include: [b]
+  b:
+    hosts: [host1]
+    include: [c]
+  c:
+    include: [a]
+  broken:
+    include: [missing]
+  badinclude:
+    include: web
+`)
+	tests := map[string]string{
+		"a":          "host group cycle: a -> b -> c -> a",
+		"missing":    `unknown host group "missing"`,
+		"broken":     `host group "broken" includes unknown group "missing"`,
+		"badinclude": `host group "badinclude" include must be a list of group names`,
+		"b,,a":       `invalid host group expression "b,,a"`,
+		"b&":         `invalid host group expression "b&"`,
+	}
+	for expr, want := range tests {
+		_, err := resolveGroupExpr(expr, lookup)
+		if err == nil || err.Error() != want {
+			t.Fatalf("resolveGroupExpr(%q): expected %q, got %v", expr, want, err)
+		}
+	}
+}
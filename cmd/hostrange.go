@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxExpandedHosts bounds how many hosts a single pattern may expand to, so a
+// typo such as web[1-100000] fails instead of opening that many sessions.
+const maxExpandedHosts = 10000
+
+// expandHostPattern expands pdsh-style ranges and braces in a host entry:
+// web[01-03] gives web01, web02 and web03, cache[1-4,7] gives cache1 to cache4
+// and cache7, and db{a,b} gives dba and dbb. Zero padding of a range start is
+// kept for every number. Brackets containing a colon are left alone so IPv6
+// literals such as [::1]:22 still parse.
+func expandHostPattern(pattern string) ([]string, error) {
+	return expandPattern(pattern, pattern)
+}
+
+func expandPattern(pattern, original string) ([]string, error) {
+	for i := 0; i < len(pattern); i++ {
+		var (
+			close        byte
+			alternatives func(string) ([]string, error)
+		)
+		switch pattern[i] {
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end != -1 && strings.Contains(pattern[i:i+end], ":") {
+				i += end
+				continue
+			}
+			close, alternatives = ']', expandRange
+		case '{':
+			close, alternatives = '}', splitBraces
+		case ']', '}':
+			return nil, fmt.Errorf("unexpected %q in %q", pattern[i], original)
+		default:
+			continue
+		}
+
+		end := matchingClose(pattern, i, close)
+		if end == -1 {
+			return nil, fmt.Errorf("missing %q in %q", close, original)
+		}
+		items, err := alternatives(pattern[i+1 : end])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", original, err)
+		}
+		rest, err := expandPattern(pattern[end+1:], original)
+		if err != nil {
+			return nil, err
+		}
+		prefix := pattern[:i]
+		hosts := make([]string, 0, len(items)*len(rest))
+		for _, item := range items {
+			// Braces may hold further patterns, as in {web[1-2],db1}.
+			expanded, err := expandPattern(item, original)
+			if err != nil {
+				return nil, err
+			}
+			for _, head := range expanded {
+				for _, tail := range rest {
+					if len(hosts) == maxExpandedHosts {
+						return nil, fmt.Errorf("%q expands to more than %d hosts", original, maxExpandedHosts)
+					}
+					hosts = append(hosts, prefix+head+tail)
+				}
+			}
+		}
+		return hosts, nil
+	}
+	return []string{pattern}, nil
+}
+
+// matchingClose returns the index of the close byte that ends the group
+// opened at start, honoring nested braces.
+func matchingClose(pattern string, start int, close byte) int {
+	if close == ']' {
+		if end := strings.IndexByte(pattern[start:], ']'); end != -1 {
+			return start + end
+		}
+		return -1
+	}
+	depth := 0
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitBraces splits the body of a brace group on its top-level commas.
+func splitBraces(body string) ([]string, error) {
+	items := make([]string, 0)
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, body[start:])
+	if len(items) < 2 {
+		return nil, fmt.Errorf("{%s} needs at least two comma separated items", body)
+	}
+	return items, nil
+}
+
+// expandRange expands the body of a range such as 01-32 or 1-4,7.
+func expandRange(body string) ([]string, error) {
+	if body == "" {
+		return nil, fmt.Errorf("empty range []")
+	}
+	numbers := make([]string, 0)
+	for _, part := range strings.Split(body, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hi = lo
+		}
+		start, err := parseRangeBound(lo, part)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseRangeBound(hi, part)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("range %q starts after it ends", part)
+		}
+		if end-start >= maxExpandedHosts {
+			return nil, fmt.Errorf("range %q has more than %d hosts", part, maxExpandedHosts)
+		}
+		width := 0
+		if len(lo) > 1 && lo[0] == '0' {
+			width = len(lo)
+		}
+		for n := start; n <= end; n++ {
+			numbers = append(numbers, fmt.Sprintf("%0*d", width, n))
+		}
+	}
+	return numbers, nil
+}
+
+func parseRangeBound(bound, part string) (int, error) {
+	if bound == "" {
+		return 0, fmt.Errorf("range %q is missing a number", part)
+	}
+	for _, r := range bound {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("range %q must only contain numbers", part)
+		}
+	}
+	return strconv.Atoi(bound)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpandHostPattern(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"host1", []string{"host1"}},
+		{"web[01-03].example.com", []string{"web01.example.com", "web02.example.com", "web03.example.com"}},
+		{"db{a,b,c}.dc1:2222", []string{"dba.dc1:2222", "dbb.dc1:2222", "dbc.dc1:2222"}},
+		{"user@cache[1-4,7]", []string{"user@cache1", "user@cache2", "user@cache3", "user@cache4", "user@cache7"}},
+		{"web[8-10]", []string{"web8", "web9", "web10"}},
+		{"web[098-100]", []string{"web098", "web099", "web100"}},
+		{"rack[1-2]-node[1-2]", []string{"rack1-node1", "rack1-node2", "rack2-node1", "rack2-node2"}},
+		{"{web[1-2],db1}.dc1", []string{"web1.dc1", "web2.dc1", "db1.dc1"}},
+		{"[2001:db8::1]:2222", []string{"[2001:db8::1]:2222"}},
+		{"admin@[::1]", []string{"admin@[::1]"}},
+	}
+	for _, tc := range tests {
+		got, err := expandHostPattern(tc.input)
+		if err != nil {
+			t.Fatalf("expandHostPattern(%q): unexpected error: %v", tc.input, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("expandHostPattern(%q) = %#v", tc.input, got)
+		}
+	}
+}
+
+func TestExpandHostPatternErrors(t *testing.T) {
+	tests := map[string]string{
+		"web[]":            `invalid pattern "web[]": empty range []`,
+		"web[5-1]":         `invalid pattern "web[5-1]": range "5-1" starts after it ends`,
+		"web[a-c]":         `invalid pattern "web[a-c]": range "a-c" must only contain numbers`,
+		"web[1-]":          `invalid pattern "web[1-]": range "1-" is missing a number`,
+		"web[1,,2]":        `invalid pattern "web[1,,2]": range "" is missing a number`,
+		"web[1-3":          `missing ']' in "web[1-3"`,
+		"db{a,b":           `missing '}' in "db{a,b"`,
+		"web1]":            `unexpected ']' in "web1]"`,
+		"db{a}":            `invalid pattern "db{a}": {a} needs at least two comma separated items`,
+		"web[1-20000]":     `invalid pattern "web[1-20000]": range "1-20000" has more than 10000 hosts`,
+		"a[1-200]b[1-200]": `"a[1-200]b[1-200]" expands to more than 10000 hosts`,
+	}
+	for input, want := range tests {
+		_, err := expandHostPattern(input)
+		if err == nil || err.Error() != want {
+			t.Fatalf("expandHostPattern(%q): expected %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestParseHostsFileExpandsRanges(t *testing.T) {
+	specs, err := parseHostsFile([]byte("deploy@web[1-2]:2222\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "web1", Port: 2222, User: "deploy", PortSet: true, UserSet: true},
+		{Host: "web2", Port: 2222, User: "deploy", PortSet: true, UserSet: true},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+
+	_, err = parseHostsFile([]byte("host1\nweb[2-1]\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "starts after it ends") {
+		t.Fatalf("expected range error on line 2, got %v", err)
+	}
+}
+
+func TestParseGroupSpecsExpandsRanges(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(
+		"groups:\n" +
+			"  web:\n" +
+			"    user: deploy\n" +
+			"    hosts:\n" +
+			"      - web{a,b}\n",
+	))
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	specs, err := parseGroupSpecs(v.Get("groups.web"), "web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "weba", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"web"}},
+		{Host: "webb", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"web"}},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+}
+
+func TestParseArgsHostsExpandsRanges(t *testing.T) {
+	specs, err := parseArgsHosts([]string{"web[1-2]"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(specs) != 2 || specs[0].Host != "web1" || specs[1].Host != "web2" {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+	if _, err := parseArgsHosts([]string{"web[1-"}); err == nil || !strings.Contains(err.Error(), `invalid host "web[1-"`) {
+		t.Fatalf("expected invalid host error, got %v", err)
+	}
+}
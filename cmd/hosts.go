@@ -15,6 +15,18 @@ type HostSpec struct {
 	User    string
 	PortSet bool
 	UserSet bool
+	Groups  []string
+
+	// Settings are connection settings from the config entry of the host or
+	// its group.
+	Settings HostSettings
+
+	// Tags are the key=value pairs following the host in a hosts file.
+	Tags map[string]string
+
+	// Exclude holds the pattern of a "!pattern" entry, which removes matching
+	// hosts instead of adding one; every other field is empty.
+	Exclude string
 }
 
 func parseHostSpec(input string) (HostSpec, error) {
@@ -62,6 +74,24 @@ func parseHostSpec(input string) (HostSpec, error) {
 	return HostSpec{Host: hostPart, Port: defaultPort, User: user, UserSet: hasUser}, nil
 }
 
+// parseHostSpecs expands the ranges and braces in input and parses each
+// resulting host.
+func parseHostSpecs(input string) ([]HostSpec, error) {
+	entries, err := expandHostPattern(strings.TrimSpace(input))
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]HostSpec, 0, len(entries))
+	for _, entry := range entries {
+		spec, err := parseHostSpec(entry)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
 func splitUserHost(input string) (user, host string, hasUser bool, err error) {
 	at := strings.LastIndex(input, "@")
 	if at == -1 {
@@ -89,82 +119,277 @@ func parsePort(port string) (int, error) {
 	return value, nil
 }
 
+// parseHostsFile parses one host spec per line, optionally followed by
+// key=value tags. Blank lines are skipped and # starts a comment at the
+// beginning of a line or after whitespace.
 func parseHostsFile(data []byte) ([]HostSpec, error) {
 	lines := strings.Split(string(data), "\n")
 	specs := make([]HostSpec, 0, len(lines))
 	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
+		trimmed := strings.TrimSpace(stripComment(line))
 		if trimmed == "" {
 			continue
 		}
-		spec, err := parseHostSpec(trimmed)
+		if spec, ok, err := parseExcludeEntry(trimmed); ok {
+			if err != nil {
+				return nil, fmt.Errorf("invalid hosts file entry on line %d: %q: %v", i+1, trimmed, err)
+			}
+			specs = append(specs, spec)
+			continue
+		}
+		fields := strings.Fields(trimmed)
+		tags, err := parseTags(fields[1:])
 		if err != nil {
 			return nil, fmt.Errorf("invalid hosts file entry on line %d: %q: %v", i+1, trimmed, err)
 		}
-		specs = append(specs, spec)
+		entrySpecs, err := parseHostSpecs(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hosts file entry on line %d: %q: %v", i+1, trimmed, err)
+		}
+		for j := range entrySpecs {
+			entrySpecs[j].Tags = tags
+		}
+		specs = append(specs, entrySpecs...)
 	}
 	return specs, nil
 }
 
-func parseGroupSpecs(raw interface{}, groupName string) ([]HostSpec, error) {
-	if raw == nil {
+// stripComment drops a # comment from line. The # must start the line or
+// follow whitespace, so it may still appear inside a host or tag.
+func stripComment(line string) string {
+	for i, r := range line {
+		if r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseTags parses key=value fields into a map, or nil when there are none.
+func parseTags(fields []string) (map[string]string, error) {
+	if len(fields) == 0 {
 		return nil, nil
 	}
+	tags := make(map[string]string, len(fields))
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("tag %q must be key=value", field)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
 
+// groupObject returns the wrapper object of a host group from config.
+func groupObject(raw interface{}, groupName string) (map[string]interface{}, error) {
 	value, ok := raw.(map[string]interface{})
+	if ok {
+		return value, nil
+	}
+	alt, ok := raw.(map[interface{}]interface{})
 	if !ok {
-		if alt, ok := raw.(map[interface{}]interface{}); ok {
-			value = make(map[string]interface{}, len(alt))
-			for key, val := range alt {
-				keyStr, ok := key.(string)
-				if !ok {
-					return nil, fmt.Errorf("invalid key type %T", key)
-				}
-				value[keyStr] = val
-			}
-		} else {
-			return nil, fmt.Errorf("host group %q must be an object with hosts", groupName)
+		return nil, fmt.Errorf("host group %q must be an object with hosts", groupName)
+	}
+	value = make(map[string]interface{}, len(alt))
+	for key, val := range alt {
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid key type %T", key)
 		}
+		value[keyStr] = val
 	}
+	return value, nil
+}
 
-	hostsRaw, ok := value["hosts"]
-	if !ok {
-		return nil, fmt.Errorf("host group %q missing hosts", groupName)
+// parseGroupSpecs parses the hosts list of a group, followed by the hosts its
+// hosts_command prints. Groups included with `include` are resolved by
+// resolveGroup.
+func parseGroupSpecs(raw interface{}, groupName string) ([]HostSpec, error) {
+	if raw == nil {
+		return nil, nil
 	}
-	hostsList, ok := hostsRaw.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("host group %q hosts must be a list", groupName)
+
+	value, err := groupObject(raw, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	hostsRaw, hasHosts := value["hosts"]
+	commandRaw, hasCommand := value["hosts_command"]
+	if !hasHosts && !hasCommand {
+		if _, ok := value["include"]; ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("host group %q missing hosts, hosts_command or include", groupName)
 	}
-	if len(hostsList) == 0 {
+	var hostsList []interface{}
+	if hasHosts {
+		list, ok := hostsRaw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("host group %q hosts must be a list", groupName)
+		}
+		hostsList = list
+	}
+	if len(hostsList) == 0 && !hasCommand {
 		return nil, nil
 	}
 
-	groupUser := ""
-	if userRaw, ok := value["user"]; ok {
-		if userStr, ok := userRaw.(string); ok {
-			groupUser = strings.TrimSpace(userStr)
-		}
+	defaults, err := parseGroupDefaults(value, groupName)
+	if err != nil {
+		return nil, err
 	}
 
 	specs := make([]HostSpec, 0, len(hostsList))
 	for i, entry := range hostsList {
 		hostEntry, ok := entry.(string)
 		if !ok {
-			return nil, fmt.Errorf("host group %q hosts entry %d must be a string", groupName, i+1)
+			entrySpecs, err := parseHostObject(entry)
+			if err != nil {
+				return nil, fmt.Errorf("host group %q hosts entry %d %v", groupName, i+1, err)
+			}
+			for _, spec := range entrySpecs {
+				defaults.applyTo(&spec)
+				spec.Groups = []string{groupName}
+				specs = append(specs, spec)
+			}
+			continue
+		}
+		if spec, ok, err := parseExcludeEntry(hostEntry); ok {
+			if err != nil {
+				return nil, fmt.Errorf("host group %q hosts entry %d: %v", groupName, i+1, err)
+			}
+			specs = append(specs, spec)
+			continue
 		}
-		spec, err := parseHostSpec(hostEntry)
+		entrySpecs, err := parseHostSpecs(hostEntry)
 		if err != nil {
 			return nil, fmt.Errorf("host group %q hosts entry %d: %v", groupName, i+1, err)
 		}
-		if !spec.UserSet && groupUser != "" {
-			spec.User = groupUser
-			spec.UserSet = true
+		for _, spec := range entrySpecs {
+			defaults.applyTo(&spec)
+			spec.Groups = []string{groupName}
+			specs = append(specs, spec)
 		}
-		specs = append(specs, spec)
+	}
+
+	if hasCommand {
+		command, _ := commandRaw.(string)
+		if strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("host group %q hosts_command must be a command", groupName)
+		}
+		commandSpecs, err := hostsFromCommand(command)
+		if err != nil {
+			return nil, fmt.Errorf("host group %q: %v", groupName, err)
+		}
+		for _, spec := range commandSpecs {
+			if spec.Exclude == "" {
+				defaults.applyTo(&spec)
+				spec.Groups = []string{groupName}
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs, nil
+}
+
+// groupDefaults are the user, port and connection settings of a group, which
+// apply to its hosts, included ones among them, unless a host sets its own.
+type groupDefaults struct {
+	user     string
+	port     int
+	settings HostSettings
+}
+
+func parseGroupDefaults(value map[string]interface{}, groupName string) (groupDefaults, error) {
+	defaults := groupDefaults{user: groupUserValue(value)}
+	if raw, ok := value["port"]; ok {
+		port, err := parsePortValue(raw)
+		if err != nil {
+			return groupDefaults{}, fmt.Errorf("host group %q port: %v", groupName, err)
+		}
+		defaults.port = port
+	}
+	settings, err := parseHostSettings(value)
+	if err != nil {
+		return groupDefaults{}, fmt.Errorf("host group %q: %v", groupName, err)
+	}
+	defaults.settings = settings
+	return defaults, nil
+}
+
+func (d groupDefaults) applyTo(spec *HostSpec) {
+	if !spec.UserSet && d.user != "" {
+		spec.User = d.user
+		spec.UserSet = true
+	}
+	if !spec.PortSet && d.port != 0 {
+		spec.Port = d.port
+		spec.PortSet = true
+	}
+	spec.Settings = spec.Settings.inherit(d.settings)
+}
+
+// parseHostObject parses a group hosts entry written as an object with a
+// `host` spec and optional user, port and connection settings.
+func parseHostObject(entry interface{}) ([]HostSpec, error) {
+	value, ok := entry.(map[string]interface{})
+	if !ok {
+		if alt, ok := entry.(map[interface{}]interface{}); ok {
+			value = make(map[string]interface{}, len(alt))
+			for key, val := range alt {
+				keyStr, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("has invalid key type %T", key)
+				}
+				value[keyStr] = val
+			}
+		} else {
+			return nil, fmt.Errorf("must be a string or an object with host")
+		}
+	}
+	hostEntry, _ := value["host"].(string)
+	if strings.TrimSpace(hostEntry) == "" {
+		return nil, fmt.Errorf("must be a string or an object with host")
+	}
+	specs, err := parseHostSpecs(hostEntry)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", hostEntry, err)
+	}
+	settings, err := parseHostSettings(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %v", hostEntry, err)
+	}
+	port := 0
+	if raw, ok := value["port"]; ok {
+		if port, err = parsePortValue(raw); err != nil {
+			return nil, fmt.Errorf("%q port: %v", hostEntry, err)
+		}
+	}
+	user := groupUserValue(value)
+	for i := range specs {
+		if user != "" {
+			specs[i].User = user
+			specs[i].UserSet = true
+		}
+		if port != 0 {
+			specs[i].Port = port
+			specs[i].PortSet = true
+		}
+		specs[i].Settings = settings
 	}
 	return specs, nil
 }
 
+func groupUserValue(value map[string]interface{}) string {
+	if userRaw, ok := value["user"]; ok {
+		if userStr, ok := userRaw.(string); ok {
+			return strings.TrimSpace(userStr)
+		}
+	}
+	return ""
+}
+
 func parsePortValue(value interface{}) (int, error) {
 	switch v := value.(type) {
 	case int:
@@ -193,11 +418,11 @@ func validatePort(port int) (int, error) {
 func parseArgsHosts(args []string) ([]HostSpec, error) {
 	specs := make([]HostSpec, 0, len(args))
 	for _, arg := range args {
-		spec, err := parseHostSpec(arg)
+		argSpecs, err := parseHostSpecs(arg)
 		if err != nil {
 			return nil, fmt.Errorf("invalid host %q: %v", arg, err)
 		}
-		specs = append(specs, spec)
+		specs = append(specs, argSpecs...)
 	}
 	return specs, nil
 }
@@ -36,7 +36,7 @@ func TestParseHostSpec(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if got != tc.want {
+			if !reflect.DeepEqual(got, tc.want) {
 				t.Fatalf("unexpected spec: %+v", got)
 			}
 		})
@@ -49,7 +49,7 @@ func TestParseHostSpecUserAtHost(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := HostSpec{Host: "host1", Port: 2222, User: "deploy", PortSet: true, UserSet: true}
-	if got != want {
+	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("unexpected spec: %+v", got)
 	}
 }
@@ -60,7 +60,7 @@ func TestParseHostSpecIPv6User(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := HostSpec{Host: "2001:db8::1", Port: 2222, User: "admin", PortSet: true, UserSet: true}
-	if got != want {
+	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("unexpected spec: %+v", got)
 	}
 }
@@ -81,6 +81,30 @@ func TestParseHostsFile(t *testing.T) {
 	}
 }
 
+func TestParseHostsFileCommentsAndTags(t *testing.T) {
+	data := []byte("# fleet\nweb1:2222 role=web az=b # primary\nweb[2-3] role=web\n\t# spare\ndb#1 role=\n!web3 # retired\n")
+	specs, err := parseHostsFile(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	web := map[string]string{"role": "web"}
+	want := []HostSpec{
+		{Host: "web1", Port: 2222, PortSet: true, Tags: map[string]string{"role": "web", "az": "b"}},
+		{Host: "web2", Port: defaultPort, Tags: web},
+		{Host: "web3", Port: defaultPort, Tags: web},
+		{Host: "db#1", Port: defaultPort, Tags: map[string]string{"role": ""}},
+		{Exclude: "web3"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+
+	_, err = parseHostsFile([]byte("web1\nweb2 primary\n"))
+	if err == nil || err.Error() != `invalid hosts file entry on line 2: "web2 primary": tag "primary" must be key=value` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestParseHostsFileInvalidPort(t *testing.T) {
 	_, err := parseHostsFile([]byte("host1:abc\n"))
 	if err == nil {
@@ -112,8 +136,8 @@ func TestParseGroupSpecsFromViper(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := []HostSpec{
-		{Host: "host1", Port: defaultPort, User: "deploy", UserSet: true},
-		{Host: "host2", Port: 2222, User: "deploy", PortSet: true, UserSet: true},
+		{Host: "host1", Port: defaultPort, User: "deploy", UserSet: true, Groups: []string{"testbed"}},
+		{Host: "host2", Port: 2222, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"testbed"}},
 	}
 	if !reflect.DeepEqual(specs, want) {
 		t.Fatalf("unexpected specs: %+v", specs)
@@ -140,8 +164,8 @@ func TestParseGroupSpecsUserPrecedence(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := []HostSpec{
-		{Host: "host1", Port: 2222, User: "admin", PortSet: true, UserSet: true},
-		{Host: "host2", Port: 2223, User: "deploy", PortSet: true, UserSet: true},
+		{Host: "host1", Port: 2222, User: "admin", PortSet: true, UserSet: true, Groups: []string{"prod"}},
+		{Host: "host2", Port: 2223, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"prod"}},
 	}
 	if !reflect.DeepEqual(specs, want) {
 		t.Fatalf("unexpected specs: %+v", specs)
@@ -291,7 +315,7 @@ func TestParseGroupSpecsMapInterfaceInterface(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := []HostSpec{
-		{Host: "host1", Port: defaultPort},
+		{Host: "host1", Port: defaultPort, Groups: []string{"alt"}},
 	}
 	if !reflect.DeepEqual(specs, want) {
 		t.Fatalf("unexpected specs: %+v", specs)
@@ -376,7 +400,7 @@ func TestParseHostSpecIPv6WithPort(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := HostSpec{Host: "::1", Port: 22, PortSet: true}
-	if got != want {
+	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("expected %+v, got %+v", want, got)
 	}
 }
@@ -387,7 +411,7 @@ func TestParseHostSpecIPv6NoBrackets(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	want := HostSpec{Host: "2001:db8::1", Port: defaultPort}
-	if got != want {
+	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("expected %+v, got %+v", want, got)
 	}
 }
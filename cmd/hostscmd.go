@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// hostsCommandTimeout bounds how long a hosts_command or --hosts-cmd may run,
+// so a discovery service that never answers does not hang the CLI.
+var hostsCommandTimeout = 30 * time.Second
+
+// runHostsCommandFunc runs a host discovery command and returns its stdout. It
+// is a package variable so tests can substitute a stub without shelling out.
+var runHostsCommandFunc = runHostsCommand
+
+// runHostsCommand runs command via the local shell (sh -c / cmd /C on
+// Windows). A non-zero exit is an error that carries the command's stderr.
+func runHostsCommand(command string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hostsCommandTimeout)
+	defer cancel()
+
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	// Children of the shell may keep the pipes open after it is killed.
+	c.WaitDelay = time.Second
+
+	if err := c.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("hosts command %q timed out after %s", command, hostsCommandTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("hosts command %q failed: %v: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("hosts command %q failed: %v", command, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// hostsFromCommand runs command and parses the hosts it prints, either in the
+// hosts file format or as a JSON array whose entries are host specs or
+// objects like group hosts entries.
+func hostsFromCommand(command string) ([]HostSpec, error) {
+	output, err := runHostsCommandFunc(command)
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	if err := json.Unmarshal(output, &list); err != nil {
+		specs, err := parseHostsFile(output)
+		if err != nil {
+			return nil, fmt.Errorf("hosts command %q: %v", command, err)
+		}
+		return specs, nil
+	}
+	specs := make([]HostSpec, 0, len(list))
+	for i, entry := range list {
+		entrySpecs, err := parseJSONHost(entry)
+		if err != nil {
+			return nil, fmt.Errorf("hosts command %q entry %d: %v", command, i+1, err)
+		}
+		specs = append(specs, entrySpecs...)
+	}
+	return specs, nil
+}
+
+func parseJSONHost(entry interface{}) ([]HostSpec, error) {
+	hostEntry, ok := entry.(string)
+	if !ok {
+		return parseHostObject(entry)
+	}
+	if spec, ok, err := parseExcludeEntry(hostEntry); ok {
+		if err != nil {
+			return nil, err
+		}
+		return []HostSpec{spec}, nil
+	}
+	return parseHostSpecs(hostEntry)
+}
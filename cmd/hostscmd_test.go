@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func stubHostsCommand(t *testing.T, outputs map[string]string) {
+	t.Helper()
+	prev := runHostsCommandFunc
+	t.Cleanup(func() { runHostsCommandFunc = prev })
+	runHostsCommandFunc = func(command string) ([]byte, error) {
+		output, ok := outputs[command]
+		if !ok {
+			t.Fatalf("unexpected hosts command %q", command)
+		}
+		return []byte(output), nil
+	}
+}
+
+func TestHostsFromCommandParsesHostsFileFormat(t *testing.T) {
+	stubHostsCommand(t, map[string]string{"discover": "web[1-2]\n\ndeploy@db1:2222\n!web2\n"})
+	specs, err := hostsFromCommand("discover")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "web1", Port: defaultPort},
+		{Host: "web2", Port: defaultPort},
+		{Host: "db1", Port: 2222, User: "deploy", PortSet: true, UserSet: true},
+		{Exclude: "web2"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+}
+
+func TestHostsFromCommandParsesJSON(t *testing.T) {
+	stubHostsCommand(t, map[string]string{"discover": `["web1", {"host": "db1", "port": 2222, "user": "postgres"}]`})
+	specs, err := hostsFromCommand("discover")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := hostNames(specs); !reflect.DeepEqual(names, []string{"web1:22", "db1:2222"}) {
+		t.Fatalf("unexpected hosts: %v", names)
+	}
+	if specs[1].User != "postgres" || !specs[1].UserSet {
+		t.Fatalf("expected user from JSON object, got %+v", specs[1])
+	}
+}
+
+func TestHostsFromCommandRejectsInvalidJSONEntry(t *testing.T) {
+	stubHostsCommand(t, map[string]string{"discover": `["web1", 42]`})
+	_, err := hostsFromCommand("discover")
+	if err == nil || err.Error() != `hosts command "discover" entry 2: must be a string or an object with host` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseGroupSpecsHostsCommand(t *testing.T) {
+	stubHostsCommand(t, map[string]string{"consul catalog nodes": "db1\ndb2\n!db1\n"})
+	raw := map[string]interface{}{
+		"user":          "postgres",
+		"hosts":         []interface{}{"db0"},
+		"hosts_command": "consul catalog nodes",
+	}
+	specs, err := parseGroupSpecs(raw, "db")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HostSpec{
+		{Host: "db0", Port: defaultPort, User: "postgres", UserSet: true, Groups: []string{"db"}},
+		{Host: "db1", Port: defaultPort, User: "postgres", UserSet: true, Groups: []string{"db"}},
+		{Host: "db2", Port: defaultPort, User: "postgres", UserSet: true, Groups: []string{"db"}},
+		{Exclude: "db1"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+
+	if _, err := parseGroupSpecs(map[string]interface{}{"hosts_command": 1}, "db"); err == nil || err.Error() != `host group "db" hosts_command must be a command` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadHostListAppendsHostsCommand(t *testing.T) {
+	prevCommand := hostsCommand
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		hostsCommand = prevCommand
+		loadSSHConfigFunc = prevLoad
+	})
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	stubHostsCommand(t, map[string]string{"discover": "web2\nweb3\n"})
+	hostsCommand = "discover"
+
+	hostList, err := loadHostList([]string{"web1", "cache1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := make([]string, 0, hostList.Len())
+	for _, host := range hostList.Hosts() {
+		names = append(names, host.Hostname)
+	}
+	if !reflect.DeepEqual(names, []string{"web1:22", "cache1:22", "web2:22", "web3:22"}) {
+		t.Fatalf("unexpected hosts: %v", names)
+	}
+}
+
+func TestRunHostsCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX shell not available on Windows CI images")
+	}
+	output, err := runHostsCommand("printf 'web1\\nweb2\\n'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "web1\nweb2\n" {
+		t.Fatalf("unexpected output: %q", output)
+	}
+
+	_, err = runHostsCommand("echo 'no such service' >&2; exit 3")
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: no such service") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRunHostsCommandTimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX shell not available on Windows CI images")
+	}
+	prev := hostsCommandTimeout
+	t.Cleanup(func() { hostsCommandTimeout = prev })
+	hostsCommandTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := runHostsCommand("sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("timeout took %s", time.Since(start))
+	}
+}
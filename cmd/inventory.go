@@ -0,0 +1,651 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// inventory is an Ansible inventory read from an INI or YAML file. Every host
+// belongs to the implicit "all" group; hosts outside any other group belong
+// to "ungrouped".
+type inventory struct {
+	groups     map[string]*inventoryGroup
+	groupOrder []string
+	hosts      []string
+	hostVars   map[string]map[string]string
+}
+
+type inventoryGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+func newInventory() *inventory {
+	inv := &inventory{groups: map[string]*inventoryGroup{}, hostVars: map[string]map[string]string{}}
+	inv.group("all")
+	inv.group("ungrouped")
+	return inv
+}
+
+// loadInventory reads the inventory at path. Files ending in .yml, .yaml or
+// .json, and files whose content is a YAML mapping, are read as YAML; any
+// other file as INI.
+func loadInventory(path string) (*inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read inventory: %w", err)
+	}
+	var inv *inventory
+	if isYAMLInventory(path, data) {
+		inv, err = parseYAMLInventory(data)
+	} else {
+		inv, err = parseINIInventory(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %w", path, err)
+	}
+	return inv, nil
+}
+
+// loadInventoryHosts resolves the --hostGroup expression expr against the
+// inventory at path. An empty expr selects every host.
+func loadInventoryHosts(path, expr string) ([]HostSpec, error) {
+	inv, err := loadInventory(path)
+	if err != nil {
+		return nil, err
+	}
+	if expr == "" {
+		expr = "all"
+	}
+	return evalGroupExpr(expr, inv.groupSpecs)
+}
+
+func isYAMLInventory(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return false
+	}
+	return doc.Content[0].Kind == yaml.MappingNode
+}
+
+// group returns the group called name, creating it when needed.
+func (inv *inventory) group(name string) *inventoryGroup {
+	g := inv.groups[name]
+	if g == nil {
+		g = &inventoryGroup{vars: map[string]string{}}
+		inv.groups[name] = g
+		inv.groupOrder = append(inv.groupOrder, name)
+	}
+	return g
+}
+
+// addHost adds the hosts of entry, which may hold ranges such as www[01:50]
+// and a trailing :port, to group with the given host variables.
+func (inv *inventory) addHost(group, entry string, vars map[string]string) error {
+	names, err := expandInventoryRange(entry)
+	if err != nil {
+		return err
+	}
+	g := inv.group(group)
+	for _, name := range names {
+		host, port := name, ""
+		if strings.Count(name, ":") == 1 {
+			host, port, _ = strings.Cut(name, ":")
+		}
+		if host == "" {
+			return fmt.Errorf("invalid host %q", entry)
+		}
+		hostVars := inv.hostVars[host]
+		if hostVars == nil {
+			hostVars = map[string]string{}
+			inv.hostVars[host] = hostVars
+			inv.hosts = append(inv.hosts, host)
+		}
+		if port != "" {
+			hostVars["ansible_port"] = port
+		}
+		for key, value := range vars {
+			hostVars[key] = value
+		}
+		if !containsString(g.hosts, host) {
+			g.hosts = append(g.hosts, host)
+		}
+	}
+	return nil
+}
+
+func (inv *inventory) addChild(parent, child string) {
+	inv.group(child)
+	g := inv.group(parent)
+	if !containsString(g.children, child) {
+		g.children = append(g.children, child)
+	}
+}
+
+// finish rejects child group cycles and drops hosts that joined another group
+// from "ungrouped".
+func (inv *inventory) finish() error {
+	done := map[string]bool{}
+	for _, name := range inv.groupOrder {
+		if err := inv.checkCycle(name, nil, done); err != nil {
+			return err
+		}
+	}
+	grouped := map[string]bool{}
+	for _, name := range inv.groupOrder {
+		if name == "all" || name == "ungrouped" {
+			continue
+		}
+		for _, host := range inv.groups[name].hosts {
+			grouped[host] = true
+		}
+	}
+	ungrouped := inv.groups["ungrouped"]
+	kept := ungrouped.hosts[:0]
+	for _, host := range ungrouped.hosts {
+		if !grouped[host] {
+			kept = append(kept, host)
+		}
+	}
+	ungrouped.hosts = kept
+	return nil
+}
+
+func (inv *inventory) checkCycle(name string, stack []string, done map[string]bool) error {
+	for i, seen := range stack {
+		if seen == name {
+			return fmt.Errorf("inventory group cycle: %s", strings.Join(append(stack[i:], name), " -> "))
+		}
+	}
+	if done[name] {
+		return nil
+	}
+	stack = append(stack[:len(stack):len(stack)], name)
+	for _, child := range inv.groups[name].children {
+		if err := inv.checkCycle(child, stack, done); err != nil {
+			return err
+		}
+	}
+	done[name] = true
+	return nil
+}
+
+// groupSpecs returns the hosts of a group followed by those of its child
+// groups, or every host for "all".
+func (inv *inventory) groupSpecs(name string) ([]HostSpec, error) {
+	if _, ok := inv.groups[name]; !ok {
+		return nil, fmt.Errorf("unknown inventory group %q", name)
+	}
+	var hosts []string
+	if name == "all" {
+		hosts = inv.hosts
+	} else {
+		hosts = inv.groupHosts(name, nil)
+	}
+	specs := make([]HostSpec, 0, len(hosts))
+	for _, host := range hosts {
+		spec, err := inv.hostSpec(host)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func (inv *inventory) groupHosts(name string, hosts []string) []string {
+	g := inv.groups[name]
+	for _, host := range g.hosts {
+		if !containsString(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, child := range g.children {
+		hosts = inv.groupHosts(child, hosts)
+	}
+	return hosts
+}
+
+// hostSpec builds the spec of host from ansible_host, ansible_port and
+// ansible_user, or their older ansible_ssh_* names. The host is tagged with
+// every group it belongs to, child groups before their parents.
+func (inv *inventory) hostSpec(host string) (HostSpec, error) {
+	depths := map[string]int{}
+	groups := inv.hostGroups(host)
+	vars := inv.vars(host, groups, depths)
+	spec := HostSpec{Host: host, Port: defaultPort}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return inv.depth(groups[i], depths) > inv.depth(groups[j], depths)
+	})
+	for _, group := range groups {
+		if group != "all" {
+			spec.Groups = append(spec.Groups, group)
+		}
+	}
+	if value := inventoryVar(vars, "ansible_port", "ansible_ssh_port"); value != "" {
+		port, err := parsePort(value)
+		if err != nil {
+			return HostSpec{}, fmt.Errorf("inventory host %q ansible_port: %v", host, err)
+		}
+		spec.Port = port
+		spec.PortSet = true
+	}
+	if value := inventoryVar(vars, "ansible_user", "ansible_ssh_user"); value != "" {
+		spec.User = value
+		spec.UserSet = true
+	}
+	spec.Settings.HostName = inventoryVar(vars, "ansible_host", "ansible_ssh_host")
+	return spec, nil
+}
+
+// hostGroups lists the groups host belongs to, directly or through child
+// groups, in inventory order.
+func (inv *inventory) hostGroups(host string) []string {
+	member := map[string]bool{"all": true}
+	for _, name := range inv.groupOrder {
+		if containsString(inv.groups[name].hosts, host) {
+			member[name] = true
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range inv.groupOrder {
+			if member[name] {
+				continue
+			}
+			for _, child := range inv.groups[name].children {
+				if member[child] {
+					member[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	groups := make([]string, 0, len(member))
+	for _, name := range inv.groupOrder {
+		if member[name] {
+			groups = append(groups, name)
+		}
+	}
+	return groups
+}
+
+// vars merges the variables of groups and host the way Ansible does: parent
+// groups first, child groups overriding them, groups of equal depth in name
+// order, and host variables last.
+func (inv *inventory) vars(host string, groups []string, depths map[string]int) map[string]string {
+	ordered := append([]string(nil), groups...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		di, dj := inv.depth(ordered[i], depths), inv.depth(ordered[j], depths)
+		if di != dj {
+			return di < dj
+		}
+		return ordered[i] < ordered[j]
+	})
+	vars := map[string]string{}
+	for _, name := range ordered {
+		for key, value := range inv.groups[name].vars {
+			vars[key] = value
+		}
+	}
+	for key, value := range inv.hostVars[host] {
+		vars[key] = value
+	}
+	return vars
+}
+
+// depth is the length of the longest parent chain from "all" to name. Groups
+// that are nobody's child are children of "all".
+func (inv *inventory) depth(name string, depths map[string]int) int {
+	if name == "all" {
+		return 0
+	}
+	if depth, ok := depths[name]; ok {
+		return depth
+	}
+	depth := 1
+	for _, parent := range inv.groupOrder {
+		if parent != "all" && containsString(inv.groups[parent].children, name) {
+			if d := inv.depth(parent, depths) + 1; d > depth {
+				depth = d
+			}
+		}
+	}
+	depths[name] = depth
+	return depth
+}
+
+func inventoryVar(vars map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(vars[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseINIInventory reads an inventory in Ansible's INI format: [group]
+// sections of hosts with key=value variables, [group:children] sections of
+// child groups and [group:vars] sections of group variables. Hosts before the
+// first section are ungrouped.
+func parseINIInventory(data []byte) (*inventory, error) {
+	inv := newInventory()
+	section, kind := "ungrouped", ""
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name, suffix, _ := strings.Cut(trimmed[1:len(trimmed)-1], ":")
+			name = strings.TrimSpace(name)
+			if name == "" || (suffix != "" && suffix != "children" && suffix != "vars") {
+				return nil, fmt.Errorf("line %d: invalid section %q", i+1, trimmed)
+			}
+			section, kind = name, suffix
+			inv.group(section)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			key, value, ok := strings.Cut(trimmed, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return nil, fmt.Errorf("line %d: %q is not key=value", i+1, trimmed)
+			}
+			fields, err := splitInventoryLine(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			inv.group(section).vars[strings.TrimSpace(key)] = strings.Join(fields, " ")
+		case "children":
+			fields, err := splitInventoryLine(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: %q is not a group name", i+1, trimmed)
+			}
+			inv.addChild(section, fields[0])
+		default:
+			fields, err := splitInventoryLine(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			vars := make(map[string]string, len(fields)-1)
+			for _, field := range fields[1:] {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok || key == "" {
+					return nil, fmt.Errorf("line %d: %q is not key=value", i+1, field)
+				}
+				vars[key] = value
+			}
+			if err := inv.addHost(section, fields[0], vars); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+	}
+	if err := inv.finish(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// splitInventoryLine splits line on whitespace, keeping quoted text together
+// and dropping the quotes. An unquoted # starting a field ends the line.
+func splitInventoryLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				field.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case r == '#' && !inField:
+			return fields, nil
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// parseYAMLInventory reads an inventory in Ansible's YAML format, where each
+// group maps to optional hosts, children and vars mappings. Hosts listed
+// directly under all are ungrouped.
+func parseYAMLInventory(data []byte) (*inventory, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	inv := newInventory()
+	if len(doc.Content) == 0 {
+		return inv, nil
+	}
+	root := yamlTarget(doc.Content[0])
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("inventory must be a mapping of groups")
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if err := inv.addYAMLGroup(root.Content[i].Value, root.Content[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := inv.finish(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (inv *inventory) addYAMLGroup(name string, node *yaml.Node) error {
+	inv.group(name)
+	node = yamlTarget(node)
+	if yamlIsNull(node) {
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("group %q must be a mapping", name)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, yamlTarget(node.Content[i+1])
+		if yamlIsNull(value) {
+			continue
+		}
+		switch key {
+		case "hosts":
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("group %q hosts must be a mapping", name)
+			}
+			target := name
+			if name == "all" {
+				target = "ungrouped"
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				host := value.Content[j].Value
+				vars, err := yamlVars(value.Content[j+1])
+				if err != nil {
+					return fmt.Errorf("host %q: %v", host, err)
+				}
+				if err := inv.addHost(target, host, vars); err != nil {
+					return fmt.Errorf("group %q: %v", name, err)
+				}
+			}
+		case "children":
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("group %q children must be a mapping", name)
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				child := value.Content[j].Value
+				inv.addChild(name, child)
+				if err := inv.addYAMLGroup(child, value.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		case "vars":
+			vars, err := yamlVars(value)
+			if err != nil {
+				return fmt.Errorf("group %q: %v", name, err)
+			}
+			for key, value := range vars {
+				inv.group(name).vars[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+// yamlVars reads a mapping of variables. Only scalar values are kept, since
+// pretty only reads connection variables.
+func yamlVars(node *yaml.Node) (map[string]string, error) {
+	vars := map[string]string{}
+	node = yamlTarget(node)
+	if yamlIsNull(node) {
+		return vars, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("vars must be a mapping")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := yamlTarget(node.Content[i+1])
+		if value.Kind == yaml.ScalarNode && !yamlIsNull(value) {
+			vars[node.Content[i].Value] = value.Value
+		}
+	}
+	return vars, nil
+}
+
+func yamlTarget(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+func yamlIsNull(node *yaml.Node) bool {
+	return node == nil || (node.Kind == yaml.ScalarNode && node.Tag == "!!null")
+}
+
+// expandInventoryRange expands Ansible host ranges: [01:50] counts with the
+// width of a zero padded start, [a:f] walks letters and an optional third
+// field such as [1:9:2] sets the stride.
+func expandInventoryRange(entry string) ([]string, error) {
+	open := strings.Index(entry, "[")
+	if open == -1 {
+		return []string{entry}, nil
+	}
+	end := strings.Index(entry[open:], "]")
+	if end == -1 {
+		return nil, fmt.Errorf("missing ']' in %q", entry)
+	}
+	end += open
+	bounds := strings.Split(entry[open+1:end], ":")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, fmt.Errorf("invalid range in %q", entry)
+	}
+	stride := 1
+	if len(bounds) == 3 {
+		value, err := strconv.Atoi(bounds[2])
+		if err != nil || value < 1 {
+			return nil, fmt.Errorf("invalid range stride in %q", entry)
+		}
+		stride = value
+	}
+
+	var values []string
+	if first, last, ok := letterBounds(bounds[0], bounds[1]); ok {
+		for c := int(first); c <= int(last); c += stride {
+			values = append(values, string(rune(c)))
+		}
+	} else {
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid range in %q", entry)
+		}
+		last, err := strconv.Atoi(bounds[1])
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid range in %q", entry)
+		}
+		if (last-first)/stride >= maxExpandedHosts {
+			return nil, fmt.Errorf("%q expands to more than %d hosts", entry, maxExpandedHosts)
+		}
+		width := 0
+		if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+			width = len(bounds[0])
+		}
+		for n := first; n <= last; n += stride {
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		}
+	}
+
+	rest, err := expandInventoryRange(entry[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(values)*len(rest) > maxExpandedHosts {
+		return nil, fmt.Errorf("%q expands to more than %d hosts", entry, maxExpandedHosts)
+	}
+	hosts := make([]string, 0, len(values)*len(rest))
+	for _, value := range values {
+		for _, suffix := range rest {
+			hosts = append(hosts, entry[:open]+value+suffix)
+		}
+	}
+	return hosts, nil
+}
+
+func letterBounds(first, last string) (byte, byte, bool) {
+	if len(first) != 1 || len(last) != 1 {
+		return 0, 0, false
+	}
+	a, b := first[0], last[0]
+	isLetter := func(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+	if !isLetter(a) || !isLetter(b) || a > b {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+const iniInventory = `
+# edge proxies
+bastion.example.com ansible_host=203.0.113.7
+
+[web]
+web[01:03].example.com
+web-canary.example.com:2222 ansible_user="ops team" # canary
+
+[db]
+db-[a:b].example.com ansible_port=5432
+
+[db:vars]
+ansible_user=postgres
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=deploy
+ansible_port=22022
+`
+
+const yamlInventory = `
+all:
+  hosts:
+    bastion.example.com:
+      ansible_host: 203.0.113.7
+  children:
+    prod:
+      vars:
+        ansible_user: deploy
+        ansible_port: 22022
+      children:
+        web:
+          hosts:
+            web[01:03].example.com:
+            web-canary.example.com:2222:
+              ansible_user: ops team
+        db:
+          vars:
+            ansible_user: postgres
+          hosts:
+            db-[a:b].example.com:
+              ansible_port: 5432
+`
+
+func writeInventory(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write inventory: %v", err)
+	}
+	return path
+}
+
+func TestLoadInventoryHostsFormats(t *testing.T) {
+	want := []HostSpec{
+		{Host: "web01.example.com", Port: 22022, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"web", "prod"}},
+		{Host: "web02.example.com", Port: 22022, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"web", "prod"}},
+		{Host: "web03.example.com", Port: 22022, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"web", "prod"}},
+		{Host: "web-canary.example.com", Port: 2222, User: "ops team", PortSet: true, UserSet: true, Groups: []string{"web", "prod"}},
+		{Host: "db-a.example.com", Port: 5432, User: "postgres", PortSet: true, UserSet: true, Groups: []string{"db", "prod"}},
+		{Host: "db-b.example.com", Port: 5432, User: "postgres", PortSet: true, UserSet: true, Groups: []string{"db", "prod"}},
+	}
+	for name, content := range map[string]string{"hosts": iniInventory, "hosts.yml": yamlInventory, "inventory": yamlInventory} {
+		specs, err := loadInventoryHosts(writeInventory(t, name, content), "prod")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !reflect.DeepEqual(specs, want) {
+			t.Fatalf("%s: unexpected specs: %+v", name, specs)
+		}
+	}
+}
+
+func TestLoadInventoryHostsAllAndUngrouped(t *testing.T) {
+	path := writeInventory(t, "hosts", iniInventory)
+
+	specs, err := loadInventoryHosts(path, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(specs) != 7 || specs[0].Host != "bastion.example.com" {
+		t.Fatalf("unexpected specs: %+v", specs)
+	}
+	if specs[0].Settings.HostName != "203.0.113.7" || specs[0].PortSet || specs[0].UserSet {
+		t.Fatalf("unexpected bastion spec: %+v", specs[0])
+	}
+
+	specs, err = loadInventoryHosts(path, "ungrouped")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := hostNames(specs); !reflect.DeepEqual(names, []string{"bastion.example.com:22"}) {
+		t.Fatalf("unexpected ungrouped hosts: %v", names)
+	}
+}
+
+func TestLoadInventoryHostsGroupExpression(t *testing.T) {
+	path := writeInventory(t, "hosts", iniInventory)
+	specs, err := loadInventoryHosts(path, "prod&db,ungrouped")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"db-a.example.com:5432", "db-b.example.com:5432", "bastion.example.com:22"}
+	if names := hostNames(specs); !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected hosts: %v", names)
+	}
+}
+
+func TestLoadInventoryHostsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		expr    string
+		want    string
+	}{
+		{name: "hosts", content: "[web]\nweb1\n", expr: "db", want: `unknown inventory group "db"`},
+		{name: "hosts", content: "[a:children]\nb\n[b:children]\na\n", expr: "a", want: "inventory group cycle: a -> b -> a"},
+		{name: "hosts", content: "[web]\nweb1 ansible_port=ssh\n", expr: "web", want: `inventory host "web1" ansible_port: port must be a number`},
+		{name: "hosts", content: "[web:hosts]\nweb1\n", expr: "web", want: `line 1: invalid section "[web:hosts]"`},
+		{name: "hosts", content: "[web]\nweb1 ansible_user\n", expr: "web", want: `line 2: "ansible_user" is not key=value`},
+		{name: "hosts", content: "[web]\nweb[1:x]\n", expr: "web", want: `invalid range in "web[1:x]"`},
+		{name: "hosts.yml", content: "all:\n  hosts: [web1]\n", expr: "all", want: `group "all" hosts must be a mapping`},
+	}
+	for _, tt := range tests {
+		_, err := loadInventoryHosts(writeInventory(t, tt.name, tt.content), tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%q: expected error containing %q, got %v", tt.content, tt.want, err)
+		}
+	}
+}
+
+func TestExpandInventoryRange(t *testing.T) {
+	tests := map[string][]string{
+		"web1":            {"web1"},
+		"web[8:10]":       {"web8", "web9", "web10"},
+		"web[08:10]":      {"web08", "web09", "web10"},
+		"web[1:7:3]":      {"web1", "web4", "web7"},
+		"db-[a:c].dc":     {"db-a.dc", "db-b.dc", "db-c.dc"},
+		"r[1:2]n[a:b]:22": {"r1na:22", "r1nb:22", "r2na:22", "r2nb:22"},
+	}
+	for entry, want := range tests {
+		got, err := expandInventoryRange(entry)
+		if err != nil {
+			t.Fatalf("expandInventoryRange(%q): unexpected error: %v", entry, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expandInventoryRange(%q) = %v, want %v", entry, got, want)
+		}
+	}
+}
+
+func TestLoadHostListUsesInventoryAddress(t *testing.T) {
+	prevInventory := inventoryFile
+	prevGroup := hostGroup
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		inventoryFile = prevInventory
+		hostGroup = prevGroup
+		loadSSHConfigFunc = prevLoad
+	})
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	inventoryFile = writeInventory(t, "hosts", iniInventory)
+	hostGroup = "ungrouped"
+
+	hostList, err := loadHostList(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hosts := hostList.Hosts()
+	if len(hosts) != 1 {
+		t.Fatalf("unexpected hosts: %+v", hosts)
+	}
+	if hosts[0].Alias != "bastion.example.com" || hosts[0].Host != "203.0.113.7" || hosts[0].Hostname != "203.0.113.7:22" {
+		t.Fatalf("unexpected host: %+v", hosts[0])
+	}
+}
@@ -17,10 +17,11 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	homedir "github.com/mitchellh/go-homedir"
@@ -33,6 +34,10 @@ import (
 var cfgFile string
 var hostsFile string
 var hostGroup string
+var inventoryFile string
+var hostsCommand string
+var excludePatterns []string
+var tagSelectors []string
 
 var loadSSHConfigFunc = sshConn.LoadSSHConfig
 
@@ -53,124 +58,240 @@ usage:
 `,
 	//Args: cobra.MinimumNArgs(1),
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 && hostGroup == "" && hostsFile == "" {
-			return errors.New("requires at least one host, hostGroup ou hostsFile")
+		if len(args) < 1 && hostGroup == "" && hostsFile == "" && inventoryFile == "" && hostsCommand == "" {
+			return errors.New("requires at least one host, hostGroup, hostsFile, inventory or hosts-cmd")
 		}
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		argsLen := len(args)
-		hostSpecs, err := parseArgsHosts(args)
+		hostList, err := loadHostList(args)
 		if err != nil {
 			return err
 		}
-
-		if hostGroup != "" {
-			groupSpecs, err := parseGroupSpecs(viper.Get(fmt.Sprintf("groups.%s", hostGroup)), hostGroup)
-			if err != nil {
+		if hostsFile == stdinHostsFile {
+			if err := reopenStdinFunc(); err != nil {
 				return err
 			}
-			if argsLen > 1 {
-				hostSpecs = append(hostSpecs, groupSpecs...)
-			} else if argsLen < 1 {
-				hostSpecs = groupSpecs
-			}
 		}
+		spawnShellFunc(hostList)
+		return nil
+	},
+}
 
-		if hostsFile != "" {
-			data, err := ioutil.ReadFile(hostsFile)
-			if err != nil {
-				return fmt.Errorf("unable to read hostsFile: %w", err)
-			}
-			fileSpecs, err := parseHostsFile(data)
-			if err != nil {
-				return err
-			}
-			hostSpecs = append(hostSpecs, fileSpecs...)
-		}
-
-		var colors = []color.Attribute{
-			color.FgRed,
-			color.FgGreen,
-			color.FgYellow,
-			color.FgBlue,
-			color.FgMagenta,
-			color.FgCyan,
-			color.FgWhite,
-			color.FgHiRed,
-			color.FgHiGreen,
-			color.FgHiYellow,
-			color.FgHiBlue,
-			color.FgHiMagenta,
-			color.FgHiCyan,
-			color.FgHiWhite,
-		}
-
-		for len(colors) <= len(hostSpecs) {
-			colors = append(colors, colors...)
-		}
-
-		userConfigPath := ""
-		if home, err := os.UserHomeDir(); err == nil {
-			userConfigPath = filepath.Join(home, ".ssh", "config")
-		}
-		resolver, err := loadSSHConfigFunc(sshConn.SSHConfigPaths{
-			User:   userConfigPath,
-			System: "/etc/ssh/ssh_config",
-		})
+// loadHostList resolves the hosts given as args, --hostGroup, --inventory,
+// --hostsFile and --hosts-cmd into a HostList ready to be handed to the shell or the batch
+// runner. With --inventory, --hostGroup selects inventory groups instead of
+// config groups.
+func loadHostList(args []string) (*sshConn.HostList, error) {
+	argsLen := len(args)
+	hostSpecs, err := parseArgsHosts(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if hostGroup != "" || inventoryFile != "" {
+		var groupSpecs []HostSpec
+		if inventoryFile != "" {
+			groupSpecs, err = loadInventoryHosts(inventoryFile, hostGroup)
+		} else {
+			groupSpecs, err = resolveGroupExpr(hostGroup, configGroup)
+		}
 		if err != nil {
-			return fmt.Errorf("unable to load ssh config: %w", err)
+			return nil, err
+		}
+		if argsLen > 1 {
+			hostSpecs = append(hostSpecs, groupSpecs...)
+		} else if argsLen < 1 {
+			hostSpecs = groupSpecs
 		}
+	}
 
-		globalUser := strings.TrimSpace(viper.GetString("username"))
+	if hostsFile != "" {
+		data, err := readHostsFile(hostsFile)
+		if err != nil {
+			return nil, err
+		}
+		fileSpecs, err := parseHostsFile(data)
+		if err != nil {
+			return nil, err
+		}
+		hostSpecs = append(hostSpecs, fileSpecs...)
+	}
 
-		hostList := sshConn.NewHostList()
-		for pos, spec := range hostSpecs {
-			resolveSpec := sshConn.HostSpec{
-				Alias:   spec.Host,
-				Host:    spec.Host,
-				Port:    spec.Port,
-				User:    spec.User,
-				PortSet: spec.PortSet,
-				UserSet: spec.UserSet,
-			}
-			if !resolveSpec.UserSet && globalUser != "" {
-				resolveSpec.User = globalUser
-				resolveSpec.UserSet = true
+	if hostsCommand != "" {
+		commandSpecs, err := hostsFromCommand(hostsCommand)
+		if err != nil {
+			return nil, err
+		}
+		hostSpecs = append(hostSpecs, commandSpecs...)
+	}
+
+	hostSpecs, err = excludeHosts(hostSpecs, excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	hostSpecs, err = filterTags(hostSpecs, tagSelectors)
+	if err != nil {
+		return nil, err
+	}
+
+	var colors = []color.Attribute{
+		color.FgRed,
+		color.FgGreen,
+		color.FgYellow,
+		color.FgBlue,
+		color.FgMagenta,
+		color.FgCyan,
+		color.FgWhite,
+		color.FgHiRed,
+		color.FgHiGreen,
+		color.FgHiYellow,
+		color.FgHiBlue,
+		color.FgHiMagenta,
+		color.FgHiCyan,
+		color.FgHiWhite,
+	}
+
+	for len(colors) <= len(hostSpecs) {
+		colors = append(colors, colors...)
+	}
+
+	userConfigPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		userConfigPath = filepath.Join(home, ".ssh", "config")
+	}
+	resolver, err := loadSSHConfigFunc(sshConn.SSHConfigPaths{
+		User:   userConfigPath,
+		System: "/etc/ssh/ssh_config",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load ssh config: %w", err)
+	}
+
+	globalUser := strings.TrimSpace(viper.GetString("username"))
+	overrides, err := loadConnectionOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	hostList := sshConn.NewHostList()
+	for pos, spec := range hostSpecs {
+		resolveSpec := sshConn.HostSpec{
+			Alias:   spec.Host,
+			Host:    spec.Host,
+			Port:    spec.Port,
+			User:    spec.User,
+			PortSet: spec.PortSet,
+			UserSet: spec.UserSet,
+		}
+		if !resolveSpec.UserSet && globalUser != "" {
+			resolveSpec.User = globalUser
+			resolveSpec.UserSet = true
+		}
+		resolved, err := resolveHostFunc(resolver, resolveSpec, "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve host %q: %w", spec.Host, err)
+		}
+		overrides.apply(&resolved)
+		spec.Settings.apply(&resolved)
+		jumps := make([]sshConn.ResolvedHost, 0, len(resolved.ProxyJump))
+		for _, jumpAlias := range resolved.ProxyJump {
+			jumpSpec := sshConn.HostSpec{Alias: jumpAlias, Host: jumpAlias}
+			if globalUser != "" {
+				jumpSpec.User = globalUser
+				jumpSpec.UserSet = true
 			}
-			resolved, err := resolveHostFunc(resolver, resolveSpec, "")
+			jumpResolved, err := resolveHostFunc(resolver, jumpSpec, "")
 			if err != nil {
-				return fmt.Errorf("unable to resolve host %q: %w", spec.Host, err)
-			}
-			jumps := make([]sshConn.ResolvedHost, 0, len(resolved.ProxyJump))
-			for _, jumpAlias := range resolved.ProxyJump {
-				jumpSpec := sshConn.HostSpec{Alias: jumpAlias, Host: jumpAlias}
-				if globalUser != "" {
-					jumpSpec.User = globalUser
-					jumpSpec.UserSet = true
-				}
-				jumpResolved, err := resolveHostFunc(resolver, jumpSpec, "")
-				if err != nil {
-					return fmt.Errorf("unable to resolve jump host %q: %w", jumpAlias, err)
-				}
-				jumps = append(jumps, jumpResolved)
+				return nil, fmt.Errorf("unable to resolve jump host %q: %w", jumpAlias, err)
 			}
-			displayName := hostDisplayName(HostSpec{Host: resolved.Host, Port: resolved.Port})
-			host := &sshConn.Host{
-				Hostname:      displayName,
-				Alias:         resolved.Alias,
-				Host:          resolved.Host,
-				Port:          resolved.Port,
-				User:          resolved.User,
-				IdentityFiles: resolved.IdentityFiles,
-				ProxyJump:     jumps,
-				Color:         color.New(colors[pos%len(colors)]),
+			overrides.apply(&jumpResolved)
+			// Configured keys and known_hosts usually cover the bastion
+			// too; the jump host's own identity files are still tried.
+			jumpResolved.IdentityFiles = append(append([]string(nil), spec.Settings.IdentityFiles...), jumpResolved.IdentityFiles...)
+			if resolved.KnownHosts != "" {
+				jumpResolved.KnownHosts = resolved.KnownHosts
 			}
-			hostList.AddHost(host)
+			jumps = append(jumps, jumpResolved)
 		}
-		spawnShellFunc(hostList)
-		return nil
-	},
+		displayName := hostDisplayName(HostSpec{Host: resolved.Host, Port: resolved.Port})
+		host := &sshConn.Host{
+			Hostname:      displayName,
+			Alias:         resolved.Alias,
+			Host:          resolved.Host,
+			Port:          resolved.Port,
+			User:          resolved.User,
+			IdentityFiles: resolved.IdentityFiles,
+			ProxyJump:     jumps,
+			Groups:        spec.Groups,
+			Tags:          spec.Tags,
+			Color:         spec.Settings.color(colors[pos%len(colors)]),
+
+			ConnectTimeout:      resolved.ConnectTimeout,
+			ServerAliveInterval: resolved.ServerAliveInterval,
+			ServerAliveCountMax: resolved.ServerAliveCountMax,
+
+			KnownHosts: resolved.KnownHosts,
+			Env:        spec.Settings.Env,
+
+			PasswordAuth:       resolved.PasswordAuthentication,
+			KbdInteractiveAuth: resolved.KbdInteractiveAuthentication,
+		}
+		hostList.AddHost(host)
+	}
+	if err := askPasswords(hostList, strings.TrimSpace(viper.GetString("ask_pass"))); err != nil {
+		return nil, err
+	}
+	if err := unlockIdentities(hostList); err != nil {
+		return nil, err
+	}
+	return hostList, nil
+}
+
+// connectionOverrides holds the connect_timeout, server_alive_interval and
+// server_alive_count_max config keys, which take precedence over the values
+// resolved from SSH config.
+type connectionOverrides struct {
+	connectTimeout      *time.Duration
+	serverAliveInterval *time.Duration
+	serverAliveCountMax *int
+}
+
+func loadConnectionOverrides() (connectionOverrides, error) {
+	var overrides connectionOverrides
+	for key, target := range map[string]**time.Duration{
+		"connect_timeout":       &overrides.connectTimeout,
+		"server_alive_interval": &overrides.serverAliveInterval,
+	} {
+		if !viper.IsSet(key) {
+			continue
+		}
+		value, err := sshConn.ParseSSHDuration(viper.GetString(key))
+		if err != nil {
+			return connectionOverrides{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*target = &value
+	}
+	if viper.IsSet("server_alive_count_max") {
+		value, err := strconv.Atoi(strings.TrimSpace(viper.GetString("server_alive_count_max")))
+		if err != nil || value < 0 {
+			return connectionOverrides{}, fmt.Errorf("invalid server_alive_count_max: %q", viper.GetString("server_alive_count_max"))
+		}
+		overrides.serverAliveCountMax = &value
+	}
+	return overrides, nil
+}
+
+func (o connectionOverrides) apply(resolved *sshConn.ResolvedHost) {
+	if o.connectTimeout != nil {
+		resolved.ConnectTimeout = *o.connectTimeout
+	}
+	if o.serverAliveInterval != nil {
+		resolved.ServerAliveInterval = *o.serverAliveInterval
+	}
+	if o.serverAliveCountMax != nil {
+		resolved.ServerAliveCountMax = *o.serverAliveCountMax
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -182,10 +303,21 @@ func Execute() error {
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pretty.yaml)")
-	RootCmd.PersistentFlags().StringVarP(&hostsFile, "hostsFile", "H", "", "hosts file to be used instead of the args via stdout (one host per line, format: host or host:port)")
-	RootCmd.PersistentFlags().StringVarP(&hostGroup, "hostGroup", "G", "", "group of hosts to be loaded from the config file")
+	RootCmd.PersistentFlags().StringVarP(&hostsFile, "hostsFile", "H", "", "hosts file to load, one host per line with optional key=value tags (- reads stdin)")
+	RootCmd.PersistentFlags().StringVarP(&hostGroup, "hostGroup", "G", "", "group of hosts to be loaded from the config file (combine groups with , or + for their union and & for their intersection)")
+	RootCmd.PersistentFlags().StringVar(&hostsCommand, "hosts-cmd", "", "local command printing hosts to load (hosts file format or a JSON array)")
+	RootCmd.PersistentFlags().StringVar(&inventoryFile, "inventory", "", "Ansible inventory (INI or YAML) to load hosts from; -G selects its groups (default all)")
+	RootCmd.PersistentFlags().StringArrayVarP(&excludePatterns, "exclude", "x", nil, "hosts to leave out: host specs, globs such as 'web*' or /regex/ (comma separated or repeated)")
+	RootCmd.PersistentFlags().StringArrayVar(&tagSelectors, "tag", nil, "only load hosts with this hosts file tag, as key=value or key (repeat to require several)")
 	RootCmd.PersistentFlags().String("prompt", "", "prompt to display in the interactive shell")
 	_ = viper.BindPFlag("prompt", RootCmd.PersistentFlags().Lookup("prompt"))
+	RootCmd.PersistentFlags().Int("forks", 0, "maximum number of concurrent sessions for async and batch runs (0 means no limit)")
+	_ = viper.BindPFlag("async_concurrency", RootCmd.PersistentFlags().Lookup("forks"))
+	RootCmd.PersistentFlags().String("output-dir", "", "write job output to <dir>/<job-id>/<host>.out and .err plus a summary.json per job")
+	_ = viper.BindPFlag("output_dir", RootCmd.PersistentFlags().Lookup("output-dir"))
+	RootCmd.PersistentFlags().String("ask-pass", "", "prompt for an SSH password before connecting: once for all hosts or per-host (default once)")
+	RootCmd.PersistentFlags().Lookup("ask-pass").NoOptDefVal = askPassOnce
+	_ = viper.BindPFlag("ask_pass", RootCmd.PersistentFlags().Lookup("ask-pass"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -197,7 +329,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
@@ -212,6 +344,7 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// stderr keeps stdout clean for `exec --output json`.
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
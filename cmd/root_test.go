@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ncode/pretty/internal/sshConn"
 	"github.com/spf13/viper"
@@ -324,6 +325,77 @@ func TestExecuteAppliesGlobalUserToHostAndJumpSpecs(t *testing.T) {
 	}
 }
 
+func TestExecuteAppliesConnectionOverrides(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	prevResolve := resolveHostFunc
+	prevSpawn := spawnShellFunc
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		resolveHostFunc = prevResolve
+		spawnShellFunc = prevSpawn
+		viper.Set("connect_timeout", nil)
+		viper.Set("server_alive_interval", nil)
+		viper.Set("server_alive_count_max", nil)
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	resolveHostFunc = func(resolver *sshConn.SSHConfigResolver, spec sshConn.HostSpec, fallbackUser string) (sshConn.ResolvedHost, error) {
+		return sshConn.ResolvedHost{Alias: spec.Alias, Host: spec.Host, Port: 22, ConnectTimeout: time.Minute, ServerAliveInterval: time.Minute, ServerAliveCountMax: 9}, nil
+	}
+	var got *sshConn.Host
+	spawnShellFunc = func(hostList *sshConn.HostList) {
+		got = hostList.Hosts()[0]
+	}
+	viper.Set("connect_timeout", "5")
+	viper.Set("server_alive_interval", "15s")
+	viper.Set("server_alive_count_max", 2)
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"host1"})
+
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ConnectTimeout != 5*time.Second || got.ServerAliveInterval != 15*time.Second || got.ServerAliveCountMax != 2 {
+		t.Fatalf("unexpected connection settings: timeout=%s interval=%s countMax=%d", got.ConnectTimeout, got.ServerAliveInterval, got.ServerAliveCountMax)
+	}
+}
+
+func TestExecuteRejectsInvalidConnectionOverride(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevHostsFile := hostsFile
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		hostsFile = prevHostsFile
+		loadSSHConfigFunc = prevLoad
+		viper.Set("server_alive_interval", nil)
+		RootCmd.SetArgs(nil)
+	})
+
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	viper.Set("server_alive_interval", "often")
+
+	hostGroup = ""
+	hostsFile = ""
+	RootCmd.SetArgs([]string{"host1"})
+
+	err := Execute()
+	if err == nil || !strings.Contains(err.Error(), "invalid server_alive_interval") {
+		t.Fatalf("expected invalid override error, got %v", err)
+	}
+}
+
 func TestInitConfigWithNonExistentFile(t *testing.T) {
 	prevCfgFile := cfgFile
 	t.Cleanup(func() {
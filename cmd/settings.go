@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// HostSettings are the connection settings a group or host entry in config
+// may carry. Set fields override what SSH config resolves for the host.
+type HostSettings struct {
+	IdentityFiles []string
+	ProxyJump     string
+	KnownHosts    string
+	Env           map[string]string
+	PromptColor   string
+
+	// HostName replaces the address SSH config resolves for the host. It is
+	// only set from ansible_host in an inventory.
+	HostName string
+}
+
+var promptColors = map[string]color.Attribute{
+	"black":      color.FgBlack,
+	"red":        color.FgRed,
+	"green":      color.FgGreen,
+	"yellow":     color.FgYellow,
+	"blue":       color.FgBlue,
+	"magenta":    color.FgMagenta,
+	"cyan":       color.FgCyan,
+	"white":      color.FgWhite,
+	"hi-black":   color.FgHiBlack,
+	"hi-red":     color.FgHiRed,
+	"hi-green":   color.FgHiGreen,
+	"hi-yellow":  color.FgHiYellow,
+	"hi-blue":    color.FgHiBlue,
+	"hi-magenta": color.FgHiMagenta,
+	"hi-cyan":    color.FgHiCyan,
+	"hi-white":   color.FgHiWhite,
+}
+
+// parseHostSettings reads identity_file, proxy_jump, known_hosts, env and
+// prompt_color from a group or host entry object.
+func parseHostSettings(value map[string]interface{}) (HostSettings, error) {
+	var settings HostSettings
+	if raw, ok := value["identity_file"]; ok {
+		switch v := raw.(type) {
+		case string:
+			settings.IdentityFiles = []string{strings.TrimSpace(v)}
+		case []interface{}:
+			for _, entry := range v {
+				path, ok := entry.(string)
+				if !ok {
+					return HostSettings{}, fmt.Errorf("identity_file must be a path or a list of paths")
+				}
+				settings.IdentityFiles = append(settings.IdentityFiles, strings.TrimSpace(path))
+			}
+		default:
+			return HostSettings{}, fmt.Errorf("identity_file must be a path or a list of paths")
+		}
+	}
+	for key, target := range map[string]*string{
+		"proxy_jump":   &settings.ProxyJump,
+		"known_hosts":  &settings.KnownHosts,
+		"prompt_color": &settings.PromptColor,
+	} {
+		raw, ok := value[key]
+		if !ok {
+			continue
+		}
+		str, ok := raw.(string)
+		if !ok {
+			return HostSettings{}, fmt.Errorf("%s must be a string", key)
+		}
+		*target = strings.TrimSpace(str)
+	}
+	if settings.PromptColor != "" {
+		if _, ok := promptColors[settings.PromptColor]; !ok {
+			return HostSettings{}, fmt.Errorf("unknown prompt_color %q", settings.PromptColor)
+		}
+	}
+	if raw, ok := value["env"]; ok {
+		// A map would do, but config keys are case-insensitive and arrive
+		// lowercased, which is wrong for environment variables.
+		list, ok := raw.([]interface{})
+		if !ok {
+			return HostSettings{}, fmt.Errorf("env must be a list of NAME=value entries")
+		}
+		settings.Env = make(map[string]string, len(list))
+		for _, entry := range list {
+			str, _ := entry.(string)
+			name, val, ok := strings.Cut(str, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				return HostSettings{}, fmt.Errorf("env entry %q must be NAME=value", str)
+			}
+			settings.Env[strings.TrimSpace(name)] = val
+		}
+	}
+	return settings, nil
+}
+
+// inherit fills the settings s leaves unset from base. Env is merged, with the
+// variables of s winning.
+func (s HostSettings) inherit(base HostSettings) HostSettings {
+	if s.IdentityFiles == nil {
+		s.IdentityFiles = base.IdentityFiles
+	}
+	if s.ProxyJump == "" {
+		s.ProxyJump = base.ProxyJump
+	}
+	if s.KnownHosts == "" {
+		s.KnownHosts = base.KnownHosts
+	}
+	if s.PromptColor == "" {
+		s.PromptColor = base.PromptColor
+	}
+	if len(base.Env) > 0 {
+		env := make(map[string]string, len(base.Env)+len(s.Env))
+		for name, value := range base.Env {
+			env[name] = value
+		}
+		for name, value := range s.Env {
+			env[name] = value
+		}
+		s.Env = env
+	}
+	return s
+}
+
+// apply overrides the address, identity files and jump hosts SSH config
+// resolved.
+func (s HostSettings) apply(resolved *sshConn.ResolvedHost) {
+	if s.HostName != "" {
+		resolved.Host = s.HostName
+	}
+	if s.IdentityFiles != nil {
+		resolved.IdentityFiles = s.IdentityFiles
+	}
+	if s.ProxyJump != "" {
+		resolved.ProxyJump = sshConn.ParseProxyJump(s.ProxyJump)
+	}
+	if s.KnownHosts != "" {
+		resolved.KnownHosts = s.KnownHosts
+	}
+}
+
+// color returns the prompt_color attribute, or fallback when it is unset.
+func (s HostSettings) color(fallback color.Attribute) *color.Color {
+	if attr, ok := promptColors[s.PromptColor]; ok {
+		return color.New(attr)
+	}
+	return color.New(fallback)
+}
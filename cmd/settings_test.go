@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/viper"
+)
+
+func TestParseHostSettings(t *testing.T) {
+	settings, err := parseHostSettings(map[string]interface{}{
+		"identity_file": []interface{}{"~/.ssh/prod", "~/.ssh/shared"},
+		"proxy_jump":    "bastion.prod",
+		"known_hosts":   "~/.ssh/known_hosts.prod",
+		"env":           []interface{}{"HTTP_PROXY=http://proxy:3128", "EMPTY="},
+		"prompt_color":  "hi-cyan",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := HostSettings{
+		IdentityFiles: []string{"~/.ssh/prod", "~/.ssh/shared"},
+		ProxyJump:     "bastion.prod",
+		KnownHosts:    "~/.ssh/known_hosts.prod",
+		Env:           map[string]string{"HTTP_PROXY": "http://proxy:3128", "EMPTY": ""},
+		PromptColor:   "hi-cyan",
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Fatalf("unexpected settings: %+v", settings)
+	}
+
+	if settings, err := parseHostSettings(map[string]interface{}{"identity_file": "~/.ssh/id"}); err != nil || !reflect.DeepEqual(settings.IdentityFiles, []string{"~/.ssh/id"}) {
+		t.Fatalf("unexpected single identity_file: %+v, %v", settings, err)
+	}
+}
+
+func TestParseHostSettingsErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"identity_file must be a path or a list of paths": {"identity_file": 3},
+		"proxy_jump must be a string":                     {"proxy_jump": []interface{}{"a"}},
+		`unknown prompt_color "pink"`:                     {"prompt_color": "pink"},
+		"env must be a list of NAME=value entries":        {"env": map[string]interface{}{"a": "b"}},
+		`env entry "FOO" must be NAME=value`:              {"env": []interface{}{"FOO"}},
+	}
+	for want, value := range tests {
+		if _, err := parseHostSettings(value); err == nil || err.Error() != want {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+}
+
+func TestHostSettingsInherit(t *testing.T) {
+	group := HostSettings{
+		IdentityFiles: []string{"group-key"},
+		ProxyJump:     "group-bastion",
+		Env:           map[string]string{"A": "group", "B": "group"},
+		PromptColor:   "red",
+	}
+	host := HostSettings{ProxyJump: "host-bastion", Env: map[string]string{"B": "host"}}
+	got := host.inherit(group)
+	want := HostSettings{
+		IdentityFiles: []string{"group-key"},
+		ProxyJump:     "host-bastion",
+		Env:           map[string]string{"A": "group", "B": "host"},
+		PromptColor:   "red",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected settings: %+v", got)
+	}
+}
+
+const settingsConfig = `
+groups:
+  dc2:
+    user: deploy
+    port: 2222
+    identity_file: ~/.ssh/dc2
+    proxy_jump: bastion.dc2
+    env: ["REGION=dc2"]
+    hosts:
+      - web1
+      - web2:22
+      - host: db1
+        user: postgres
+        port: 5022
+        proxy_jump: none
+        known_hosts: /etc/pretty/known_hosts.db
+        env: ["ROLE=db"]
+        prompt_color: yellow
+  prod:
+    prompt_color: green
+    include: [dc2]
+`
+
+func TestParseGroupSpecsSettings(t *testing.T) {
+	specs, err := resolveGroupExpr("dc2", groupsFromYAML(t, settingsConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	groupSettings := HostSettings{
+		IdentityFiles: []string{"~/.ssh/dc2"},
+		ProxyJump:     "bastion.dc2",
+		Env:           map[string]string{"REGION": "dc2"},
+	}
+	want := []HostSpec{
+		{Host: "web1", Port: 2222, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"dc2"}, Settings: groupSettings},
+		{Host: "web2", Port: 22, User: "deploy", PortSet: true, UserSet: true, Groups: []string{"dc2"}, Settings: groupSettings},
+		{Host: "db1", Port: 5022, User: "postgres", PortSet: true, UserSet: true, Groups: []string{"dc2"}, Settings: HostSettings{
+			IdentityFiles: []string{"~/.ssh/dc2"},
+			ProxyJump:     "none",
+			KnownHosts:    "/etc/pretty/known_hosts.db",
+			Env:           map[string]string{"REGION": "dc2", "ROLE": "db"},
+			PromptColor:   "yellow",
+		}},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Fatalf("unexpected specs:\n%+v\nwant\n%+v", specs, want)
+	}
+
+	specs, err = resolveGroupExpr("prod", groupsFromYAML(t, settingsConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if specs[0].Settings.PromptColor != "green" || specs[2].Settings.PromptColor != "yellow" {
+		t.Fatalf("expected prod color only where unset, got %+v", specs)
+	}
+}
+
+func TestParseGroupSpecsHostObjectErrors(t *testing.T) {
+	tests := map[string][]interface{}{
+		"must be a string or an object with host":       {map[string]interface{}{"port": 22}},
+		`"web1" port: port must be between 1 and 65535`: {map[string]interface{}{"host": "web1", "port": 0}},
+		`"web1": unknown prompt_color "pink"`:           {map[string]interface{}{"host": "web1", "prompt_color": "pink"}},
+	}
+	for want, hosts := range tests {
+		_, err := parseGroupSpecs(map[string]interface{}{"hosts": hosts}, "g")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error containing %q, got %v", want, err)
+		}
+	}
+	if _, err := parseGroupSpecs(map[string]interface{}{"port": "x", "hosts": []interface{}{"web1"}}, "g"); err == nil || err.Error() != `host group "g" port: port must be a number` {
+		t.Fatalf("unexpected group port error: %v", err)
+	}
+}
+
+func TestLoadHostListAppliesHostSettings(t *testing.T) {
+	prevHostGroup := hostGroup
+	prevLoad := loadSSHConfigFunc
+	prevResolve := resolveHostFunc
+	t.Cleanup(func() {
+		hostGroup = prevHostGroup
+		loadSSHConfigFunc = prevLoad
+		resolveHostFunc = prevResolve
+		viper.Reset()
+	})
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(settingsConfig)); err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	resolveHostFunc = func(resolver *sshConn.SSHConfigResolver, spec sshConn.HostSpec, fallbackUser string) (sshConn.ResolvedHost, error) {
+		return sshConn.ResolvedHost{
+			Alias:         spec.Alias,
+			Host:          spec.Host,
+			Port:          spec.Port,
+			User:          spec.User,
+			IdentityFiles: []string{"~/.ssh/id_" + spec.Alias},
+			ProxyJump:     []string{"ssh-config-bastion"},
+		}, nil
+	}
+	hostGroup = "dc2"
+
+	hostList, err := loadHostList(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hosts := hostList.Hosts()
+	if len(hosts) != 3 {
+		t.Fatalf("expected 3 hosts, got %d", len(hosts))
+	}
+
+	web := hosts[0]
+	if web.Hostname != "web1:2222" || !reflect.DeepEqual(web.IdentityFiles, []string{"~/.ssh/dc2"}) {
+		t.Fatalf("unexpected web host: %+v", web)
+	}
+	if len(web.ProxyJump) != 1 || web.ProxyJump[0].Alias != "bastion.dc2" {
+		t.Fatalf("expected configured bastion, got %+v", web.ProxyJump)
+	}
+	if !reflect.DeepEqual(web.ProxyJump[0].IdentityFiles, []string{"~/.ssh/dc2", "~/.ssh/id_bastion.dc2"}) {
+		t.Fatalf("expected configured key on the bastion, got %v", web.ProxyJump[0].IdentityFiles)
+	}
+	if !reflect.DeepEqual(web.Env, map[string]string{"REGION": "dc2"}) {
+		t.Fatalf("unexpected env: %v", web.Env)
+	}
+
+	db := hosts[2]
+	if db.Hostname != "db1:5022" || db.User != "postgres" || len(db.ProxyJump) != 0 || db.KnownHosts != "/etc/pretty/known_hosts.db" {
+		t.Fatalf("unexpected db host: %+v", db)
+	}
+	if !db.Color.Equals(color.New(color.FgYellow)) {
+		t.Fatalf("expected yellow prompt color")
+	}
+}
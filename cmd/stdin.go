@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+)
+
+// stdinHostsFile is the --hostsFile value that reads hosts from stdin.
+const stdinHostsFile = "-"
+
+var stdinReader io.Reader = os.Stdin
+
+var reopenStdinFunc = reopenStdin
+
+// readHostsFile reads the hosts file at path, or stdin for "-".
+func readHostsFile(path string) ([]byte, error) {
+	if path == stdinHostsFile {
+		data, err := ioutil.ReadAll(stdinReader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read hosts from stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read hostsFile: %w", err)
+	}
+	return data, nil
+}
+
+// reopenStdin points os.Stdin at the controlling terminal once the host list
+// has consumed the original stdin, so the interactive shell still gets
+// keyboard input.
+func reopenStdin() error {
+	tty, err := os.OpenFile(ttyPath(), os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("hosts were read from stdin and the terminal cannot be reopened for input: %w", err)
+	}
+	os.Stdin = tty
+	return nil
+}
+
+// ttyPath is the controlling terminal's device.
+func ttyPath() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}
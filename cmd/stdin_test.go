@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ncode/pretty/internal/shell"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func stubStdin(t *testing.T, input string) *int {
+	t.Helper()
+	prevHostsFile := hostsFile
+	prevStdin := stdinReader
+	prevReopen := reopenStdinFunc
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		hostsFile = prevHostsFile
+		stdinReader = prevStdin
+		reopenStdinFunc = prevReopen
+		loadSSHConfigFunc = prevLoad
+		RootCmd.SetArgs(nil)
+	})
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	stdinReader = strings.NewReader(input)
+	reopened := 0
+	reopenStdinFunc = func() error {
+		reopened++
+		return nil
+	}
+	return &reopened
+}
+
+func TestExecuteReadsHostsFromStdinAndReopensTTY(t *testing.T) {
+	reopened := stubStdin(t, "web1\nweb2:2222 role=web\n")
+	prevSpawn := spawnShellFunc
+	t.Cleanup(func() { spawnShellFunc = prevSpawn })
+	var got []string
+	spawnShellFunc = func(hostList *sshConn.HostList) {
+		if *reopened != 1 {
+			t.Fatalf("expected stdin to be reopened before the shell starts")
+		}
+		for _, host := range hostList.Hosts() {
+			got = append(got, host.Hostname)
+		}
+	}
+
+	RootCmd.SetArgs([]string{"-H", "-"})
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != "web1:22" || got[1] != "web2:2222" {
+		t.Fatalf("unexpected hosts: %#v", got)
+	}
+}
+
+func TestExecuteFailsWhenTTYCannotBeReopened(t *testing.T) {
+	stubStdin(t, "web1\n")
+	reopenStdinFunc = func() error { return errors.New("no tty") }
+	prevSpawn := spawnShellFunc
+	t.Cleanup(func() { spawnShellFunc = prevSpawn })
+	spawnShellFunc = func(hostList *sshConn.HostList) {
+		t.Fatal("unexpected spawn")
+	}
+
+	RootCmd.SetArgs([]string{"-H", "-"})
+	if err := Execute(); err == nil || err.Error() != "no tty" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestExecReadsHostsFromStdinWithoutTTY(t *testing.T) {
+	reopened := stubStdin(t, "web1\n")
+	prevExec := execShellFunc
+	t.Cleanup(func() { execShellFunc = prevExec })
+	var got []string
+	execShellFunc = func(hostList *sshConn.HostList, command string, options shell.ExecOptions, stdout, stderr io.Writer) error {
+		for _, host := range hostList.Hosts() {
+			got = append(got, host.Hostname)
+		}
+		return nil
+	}
+
+	RootCmd.SetArgs([]string{"-H", "-", "exec", "--", "uptime"})
+	if err := Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != "web1:22" {
+		t.Fatalf("unexpected hosts: %#v", got)
+	}
+	if *reopened != 0 {
+		t.Fatal("batch mode must not reopen the terminal")
+	}
+}
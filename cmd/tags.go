@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// filterTags keeps the hosts matching every --tag selector: `key=value` needs
+// that exact value and a bare `key` any value. Matching no host is an error.
+func filterTags(specs []HostSpec, selectors []string) ([]HostSpec, error) {
+	if len(selectors) == 0 {
+		return specs, nil
+	}
+	for _, selector := range selectors {
+		if key, _, _ := strings.Cut(selector, "="); strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid tag selector %q", selector)
+		}
+	}
+	kept := make([]HostSpec, 0, len(specs))
+	for _, spec := range specs {
+		matches := true
+		for _, selector := range selectors {
+			if !sshConn.MatchTag(spec.Tags, selector) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			kept = append(kept, spec)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no host has tags %s", strings.Join(selectors, ", "))
+	}
+	return kept, nil
+}
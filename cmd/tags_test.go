@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func TestFilterTags(t *testing.T) {
+	specs := []HostSpec{
+		{Host: "web1", Port: defaultPort, Tags: map[string]string{"role": "web", "az": "a"}},
+		{Host: "web2", Port: defaultPort, Tags: map[string]string{"role": "web", "az": "b"}},
+		{Host: "db1", Port: defaultPort, Tags: map[string]string{"role": "db", "az": "b"}},
+		{Host: "cache1", Port: defaultPort},
+	}
+	tests := []struct {
+		selectors []string
+		want      []string
+	}{
+		{selectors: nil, want: []string{"web1:22", "web2:22", "db1:22", "cache1:22"}},
+		{selectors: []string{"role=web"}, want: []string{"web1:22", "web2:22"}},
+		{selectors: []string{"az=b", "role=web"}, want: []string{"web2:22"}},
+		{selectors: []string{"az"}, want: []string{"web1:22", "web2:22", "db1:22"}},
+	}
+	for _, tt := range tests {
+		got, err := filterTags(specs, tt.selectors)
+		if err != nil {
+			t.Fatalf("filterTags(%v): unexpected error: %v", tt.selectors, err)
+		}
+		if names := hostNames(got); !reflect.DeepEqual(names, tt.want) {
+			t.Fatalf("filterTags(%v) = %v, want %v", tt.selectors, names, tt.want)
+		}
+	}
+
+	if _, err := filterTags(specs, []string{"role=api", "az=a"}); err == nil || err.Error() != "no host has tags role=api, az=a" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := filterTags(specs, []string{"=web"}); err == nil || err.Error() != `invalid tag selector "=web"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadHostListCarriesTags(t *testing.T) {
+	prevFile := hostsFile
+	prevTags := tagSelectors
+	prevLoad := loadSSHConfigFunc
+	t.Cleanup(func() {
+		hostsFile = prevFile
+		tagSelectors = prevTags
+		loadSSHConfigFunc = prevLoad
+	})
+	loadSSHConfigFunc = func(paths sshConn.SSHConfigPaths) (*sshConn.SSHConfigResolver, error) {
+		return &sshConn.SSHConfigResolver{}, nil
+	}
+	hostsFile = filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hostsFile, []byte("web1 role=web\ndb1 role=db\n"), 0o644); err != nil {
+		t.Fatalf("write hosts file: %v", err)
+	}
+	tagSelectors = []string{"role=db"}
+
+	hostList, err := loadHostList(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hosts := hostList.Hosts()
+	if len(hosts) != 1 || hosts[0].Hostname != "db1:22" || !reflect.DeepEqual(hosts[0].Tags, map[string]string{"role": "db"}) {
+		t.Fatalf("unexpected hosts: %+v", hosts)
+	}
+}
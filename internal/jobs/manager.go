@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,12 +14,51 @@ type Manager struct {
 	snapshotDirty  bool
 	normalSnapshot *Job
 	asyncSnapshots []*Job
+	onFinish       func(job *Job)
 }
 
 func NewManager() *Manager {
 	return &Manager{nextID: 1, snapshotDirty: true}
 }
 
+// OnJobFinished registers fn to be called once per job, outside the manager's
+// lock, with a snapshot of the job as soon as none of its hosts is queued or
+// running anymore.
+func (m *Manager) OnJobFinished(fn func(job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFinish = fn
+}
+
+// finishedLocked returns a snapshot of job the first time all of its hosts
+// are done, and nil otherwise.
+func (m *Manager) finishedLocked(job *Job) *Job {
+	if job.finished || m.onFinish == nil {
+		return nil
+	}
+	for _, status := range job.Hosts {
+		if status.State == HostQueued || status.State == HostRunning {
+			return nil
+		}
+	}
+	job.finished = true
+	return cloneJob(job)
+}
+
+// notifyFinished hands a job returned by finishedLocked to the registered
+// callback. It must be called without holding the lock.
+func (m *Manager) notifyFinished(job *Job) {
+	if job == nil {
+		return
+	}
+	m.mu.Lock()
+	fn := m.onFinish
+	m.mu.Unlock()
+	if fn != nil {
+		fn(job)
+	}
+}
+
 func (m *Manager) markDirty() {
 	m.snapshotDirty = true
 }
@@ -131,6 +171,8 @@ func (m *Manager) MarkHostRunning(jobID int, host string) {
 }
 
 func (m *Manager) MarkHostDone(jobID int, host string, exitCode int, success bool) {
+	var finished *Job
+	defer func() { m.notifyFinished(finished) }()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	job := m.findJobLocked(jobID)
@@ -144,14 +186,127 @@ func (m *Manager) MarkHostDone(jobID int, host string, exitCode int, success boo
 	if status.startedAt.IsZero() {
 		status.startedAt = time.Now()
 	}
-	status.Duration = time.Since(status.startedAt)
 	status.ExitCode = exitCode
+	if status.State == HostTimedOut {
+		// A timed out command may still report an exit code once it is
+		// interrupted; keep the timeout as the outcome.
+		m.markDirty()
+		return
+	}
+	status.Duration = time.Since(status.startedAt)
 	if success {
 		status.State = HostSuccess
 	} else {
 		status.State = HostFailed
 	}
 	m.markDirty()
+	finished = m.finishedLocked(job)
+}
+
+// MarkHostTimedOut records that host exceeded the job's timeout. It returns
+// false when the host had already finished.
+func (m *Manager) MarkHostTimedOut(jobID int, host string) bool {
+	var finished *Job
+	defer func() { m.notifyFinished(finished) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.findJobLocked(jobID)
+	if job == nil {
+		return false
+	}
+	status := job.Hosts[host]
+	if status == nil || (status.State != HostQueued && status.State != HostRunning) {
+		return false
+	}
+	if status.startedAt.IsZero() {
+		status.startedAt = time.Now()
+	}
+	status.Duration = time.Since(status.startedAt)
+	status.State = HostTimedOut
+	m.markDirty()
+	finished = m.finishedLocked(job)
+	return true
+}
+
+// MarkHostLost records that host can no longer finish, for example because
+// its session was lost while the command ran. It returns false when the host
+// had already finished.
+func (m *Manager) MarkHostLost(jobID int, host string) bool {
+	var finished *Job
+	defer func() { m.notifyFinished(finished) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.findJobLocked(jobID)
+	if job == nil {
+		return false
+	}
+	status := job.Hosts[host]
+	if status == nil || (status.State != HostQueued && status.State != HostRunning) {
+		return false
+	}
+	if status.startedAt.IsZero() {
+		status.startedAt = time.Now()
+	}
+	status.Duration = time.Since(status.startedAt)
+	status.ExitCode = 1
+	status.State = HostFailed
+	m.markDirty()
+	finished = m.finishedLocked(job)
+	return true
+}
+
+// MarkHostSkipped records that host will not run. It returns false when the
+// host had already started.
+func (m *Manager) MarkHostSkipped(jobID int, host string) bool {
+	var finished *Job
+	defer func() { m.notifyFinished(finished) }()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := m.findJobLocked(jobID)
+	if job == nil {
+		return false
+	}
+	status := job.Hosts[host]
+	if status == nil || status.State != HostQueued {
+		return false
+	}
+	status.State = HostSkipped
+	m.markDirty()
+	finished = m.finishedLocked(job)
+	return true
+}
+
+// FailedHosts returns the hosts whose most recently finished job did not
+// succeed, in the order they first appear across the retained jobs.
+func (m *Manager) FailedHosts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(m.asyncJobs)+1)
+	if m.normalJob != nil {
+		jobs = append(jobs, m.normalJob)
+	}
+	jobs = append(jobs, m.asyncJobs...)
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID > jobs[j].ID })
+
+	seen := make(map[string]bool)
+	failed := make([]string, 0)
+	for _, job := range jobs {
+		for _, host := range job.HostsOrder {
+			status := job.Hosts[host]
+			if status == nil || seen[host] {
+				continue
+			}
+			if status.State == HostQueued || status.State == HostRunning || status.State == HostSkipped {
+				continue
+			}
+			seen[host] = true
+			if status.State != HostSuccess {
+				failed = append(failed, host)
+			}
+		}
+	}
+	return failed
 }
 
 func (m *Manager) findJobLocked(jobID int) *Job {
@@ -230,3 +230,136 @@ func TestSnapshotCaching(t *testing.T) {
 		}
 	})
 }
+
+func TestFailedHostsUsesLatestFinishedJob(t *testing.T) {
+	manager := NewManager()
+	first := manager.CreateJob(JobTypeNormal, "one", []string{"host1", "host2", "host3"})
+	manager.MarkHostDone(first.ID, "host1", 1, false)
+	manager.MarkHostDone(first.ID, "host2", 1, false)
+	manager.MarkHostDone(first.ID, "host3", 0, true)
+
+	second := manager.CreateJob(JobTypeAsync, "two", []string{"host1", "host2", "host3"})
+	manager.MarkHostDone(second.ID, "host1", 0, true)
+	manager.MarkHostRunning(second.ID, "host2")
+	manager.MarkHostDone(second.ID, "host3", 2, false)
+
+	got := manager.FailedHosts()
+	if len(got) != 2 || got[0] != "host3" || got[1] != "host2" {
+		t.Fatalf("unexpected failed hosts: %#v", got)
+	}
+}
+
+func TestFailedHostsEmpty(t *testing.T) {
+	if got := NewManager().FailedHosts(); len(got) != 0 {
+		t.Fatalf("expected no failed hosts, got %#v", got)
+	}
+}
+
+func TestMarkHostTimedOut(t *testing.T) {
+	m := NewManager()
+	job := m.CreateJob(JobTypeNormal, "sleep 60", []string{"host1", "host2"})
+	m.MarkHostRunning(job.ID, "host1")
+	m.MarkHostDone(job.ID, "host2", 0, true)
+
+	if !m.MarkHostTimedOut(job.ID, "host1") {
+		t.Fatal("expected running host to time out")
+	}
+	if m.MarkHostTimedOut(job.ID, "host2") {
+		t.Fatal("expected finished host to keep its state")
+	}
+	if m.MarkHostTimedOut(999, "host1") {
+		t.Fatal("expected unknown job to be ignored")
+	}
+
+	// The interrupted command reports back later; the timeout stays.
+	m.MarkHostDone(job.ID, "host1", 130, false)
+	status := m.Job(job.ID).Hosts["host1"]
+	if status.State != HostTimedOut || status.ExitCode != 130 {
+		t.Fatalf("unexpected status after timeout: %+v", status)
+	}
+	if got := m.FailedHosts(); len(got) != 1 || got[0] != "host1" {
+		t.Fatalf("expected timed out host to count as failed, got %#v", got)
+	}
+}
+
+func TestMarkHostLost(t *testing.T) {
+	m := NewManager()
+	var finished []int
+	m.OnJobFinished(func(job *Job) { finished = append(finished, job.ID) })
+	job := m.CreateJob(JobTypeNormal, "uptime", []string{"host1", "host2"})
+	m.MarkHostRunning(job.ID, "host1")
+	m.MarkHostDone(job.ID, "host2", 0, true)
+
+	if m.MarkHostLost(job.ID, "host2") {
+		t.Fatal("expected finished host to keep its state")
+	}
+	if !m.MarkHostLost(job.ID, "host1") {
+		t.Fatal("expected running host to fail")
+	}
+	if m.MarkHostLost(0, "host1") {
+		t.Fatal("expected unknown job to be ignored")
+	}
+	status := m.Job(job.ID).Hosts["host1"]
+	if status.State != HostFailed || status.ExitCode != 1 {
+		t.Fatalf("unexpected status after losing the host: %+v", status)
+	}
+	if len(finished) != 1 || finished[0] != job.ID {
+		t.Fatalf("expected the job to finish once, got %v", finished)
+	}
+}
+
+func TestMarkHostSkipped(t *testing.T) {
+	m := NewManager()
+	job := m.CreateJob(JobTypeRolling, "deploy", []string{"host1", "host2"})
+	m.MarkHostRunning(job.ID, "host1")
+
+	if m.MarkHostSkipped(job.ID, "host1") {
+		t.Fatal("expected running host not to be skipped")
+	}
+	if !m.MarkHostSkipped(job.ID, "host2") {
+		t.Fatal("expected queued host to be skipped")
+	}
+	if state := m.Job(job.ID).Hosts["host2"].State; state != HostSkipped {
+		t.Fatalf("expected skipped, got %v", state)
+	}
+}
+
+func TestFailedHostsIgnoresSkipped(t *testing.T) {
+	m := NewManager()
+	first := m.CreateJob(JobTypeNormal, "one", []string{"host1"})
+	m.MarkHostDone(first.ID, "host1", 1, false)
+
+	second := m.CreateJob(JobTypeRolling, "two", []string{"host1"})
+	m.MarkHostSkipped(second.ID, "host1")
+
+	if got := m.FailedHosts(); len(got) != 1 || got[0] != "host1" {
+		t.Fatalf("expected earlier failure to count, got %#v", got)
+	}
+}
+
+func TestOnJobFinishedCalledOnceWhenAllHostsDone(t *testing.T) {
+	m := NewManager()
+	var finished []*Job
+	m.OnJobFinished(func(job *Job) {
+		// The callback runs without the lock held.
+		m.NormalJobs()
+		finished = append(finished, job)
+	})
+
+	job := m.CreateJob(JobTypeRolling, "deploy", []string{"host1", "host2", "host3"})
+	m.MarkHostRunning(job.ID, "host1")
+	m.MarkHostDone(job.ID, "host1", 0, true)
+	m.MarkHostTimedOut(job.ID, "host2")
+	if len(finished) != 0 {
+		t.Fatalf("expected no callback while host3 is queued, got %d", len(finished))
+	}
+	m.MarkHostSkipped(job.ID, "host3")
+	m.MarkHostDone(job.ID, "host2", 130, false)
+
+	if len(finished) != 1 {
+		t.Fatalf("expected one callback, got %d", len(finished))
+	}
+	if got := finished[0].Hosts["host3"].State; got != HostSkipped {
+		t.Fatalf("expected snapshot with host3 skipped, got %v", got)
+	}
+}
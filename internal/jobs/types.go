@@ -7,6 +7,9 @@ type JobType string
 const (
 	JobTypeNormal JobType = "normal"
 	JobTypeAsync  JobType = "async"
+	// JobTypeRolling runs over dedicated sessions like async jobs, but in
+	// waves of hosts.
+	JobTypeRolling JobType = "rolling"
 )
 
 type HostState string
@@ -16,6 +19,12 @@ const (
 	HostRunning HostState = "running"
 	HostSuccess HostState = "succeeded"
 	HostFailed  HostState = "failed"
+	// HostTimedOut marks a host that was still running when the job's
+	// timeout expired.
+	HostTimedOut HostState = "timed_out"
+	// HostSkipped marks a host that never ran because a rolling job was
+	// aborted first.
+	HostSkipped HostState = "skipped"
 )
 
 type HostStatus struct {
@@ -33,6 +42,9 @@ type Job struct {
 	Created    time.Time
 	Hosts      map[string]*HostStatus
 	HostsOrder []string
+
+	// finished is set once the OnJobFinished callback ran for the job.
+	finished bool
 }
 
 func (h *HostStatus) Elapsed() time.Duration {
@@ -0,0 +1,221 @@
+package shell
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+const collapseSeparator = "----------------"
+
+// jobOutputs keeps the output of each job per host so it can be grouped after
+// the fact. Only lines tagged with a job ID are kept, up to maxLines per job.
+// Whenever a new job starts producing output, jobs rejected by keep are
+// dropped.
+type jobOutputs struct {
+	mu       sync.Mutex
+	maxLines int
+	keep     func(jobID int) bool
+	jobs     map[int]*jobOutput
+}
+
+type jobOutput struct {
+	lines     int
+	truncated bool
+	hosts     map[string][]string
+}
+
+func newJobOutputs(maxLines int, keep func(jobID int) bool) *jobOutputs {
+	return &jobOutputs{maxLines: maxLines, keep: keep, jobs: map[int]*jobOutput{}}
+}
+
+// Append records line as output of host for jobID.
+func (o *jobOutputs) Append(jobID int, host, line string) {
+	if jobID <= 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := o.jobs[jobID]
+	if output == nil {
+		if o.keep != nil {
+			for id := range o.jobs {
+				if !o.keep(id) {
+					delete(o.jobs, id)
+				}
+			}
+		}
+		output = &jobOutput{hosts: map[string][]string{}}
+		o.jobs[jobID] = output
+	}
+	if output.lines >= o.maxLines {
+		output.truncated = true
+		return
+	}
+	output.hosts[host] = append(output.hosts[host], line)
+	output.lines++
+}
+
+// AppendEvent records evt when it is stdout of a job.
+func (o *jobOutputs) AppendEvent(evt sshConn.OutputEvent) {
+	if evt.Stream != sshConn.StreamStdout {
+		return
+	}
+	o.Append(evt.JobID, evt.Hostname, evt.Line)
+}
+
+// Host returns a copy of the lines host produced for jobID.
+func (o *jobOutputs) Host(jobID int, host string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := o.jobs[jobID]
+	if output == nil {
+		return nil
+	}
+	return append([]string(nil), output.hosts[host]...)
+}
+
+// Truncated reports whether output for jobID was dropped after maxLines.
+func (o *jobOutputs) Truncated(jobID int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := o.jobs[jobID]
+	return output != nil && output.truncated
+}
+
+// collapseLines groups the hosts of job whose output is identical and prints
+// each distinct output once under a compressed host list, like dshbak -c.
+// Groups appear in the order of the first host that produced them.
+func collapseLines(job *jobs.Job, outputs *jobOutputs) []string {
+	if job == nil {
+		return nil
+	}
+	type group struct {
+		hosts []string
+		lines []string
+	}
+	groups := make([]*group, 0)
+	byOutput := make(map[string]*group)
+	for _, host := range job.HostsOrder {
+		lines := outputs.Host(job.ID, host)
+		key := strings.Join(lines, "\n")
+		g := byOutput[key]
+		if g == nil {
+			g = &group{lines: lines}
+			byOutput[key] = g
+			groups = append(groups, g)
+		}
+		g.hosts = append(g.hosts, host)
+	}
+
+	out := []string{fmt.Sprintf("job %d [%s] %s: %d distinct outputs from %d hosts", job.ID, job.Type, job.Command, len(groups), len(job.HostsOrder))}
+	if outputs.Truncated(job.ID) {
+		out = append(out, fmt.Sprintf("output truncated after %d lines", outputs.maxLines))
+	}
+	for _, g := range groups {
+		out = append(out, collapseSeparator, fmt.Sprintf("%s (%d)", compressHosts(g.hosts), len(g.hosts)), collapseSeparator)
+		if len(g.lines) == 0 {
+			out = append(out, "(no output)")
+			continue
+		}
+		out = append(out, g.lines...)
+	}
+	return out
+}
+
+// compressHosts folds host names that differ only in a number into ranges,
+// so web01:22 ... web20:22 and web23:22 become web[01-20,23]:22. Zero padded
+// numbers are only folded with numbers of the same width.
+func compressHosts(hosts []string) string {
+	type series struct {
+		prefix  string
+		suffix  string
+		width   int
+		numbers []int
+		plain   string
+	}
+	all := make([]*series, 0)
+	byKey := make(map[string]*series)
+	for _, host := range hosts {
+		prefix, digits, suffix := splitHostNumber(host)
+		if digits == "" {
+			all = append(all, &series{plain: host})
+			continue
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			all = append(all, &series{plain: host})
+			continue
+		}
+		width := 0
+		if len(digits) > 1 && digits[0] == '0' {
+			width = len(digits)
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%d", prefix, suffix, width)
+		s := byKey[key]
+		if s == nil {
+			s = &series{prefix: prefix, suffix: suffix, width: width}
+			byKey[key] = s
+			all = append(all, s)
+		}
+		s.numbers = append(s.numbers, n)
+	}
+
+	parts := make([]string, 0, len(all))
+	for _, s := range all {
+		if s.plain != "" {
+			parts = append(parts, s.plain)
+			continue
+		}
+		if len(s.numbers) == 1 {
+			parts = append(parts, s.prefix+formatHostNumber(s.numbers[0], s.width)+s.suffix)
+			continue
+		}
+		sort.Ints(s.numbers)
+		ranges := make([]string, 0)
+		for i := 0; i < len(s.numbers); {
+			j := i
+			for j+1 < len(s.numbers) && s.numbers[j+1] <= s.numbers[j]+1 {
+				j++
+			}
+			if s.numbers[i] == s.numbers[j] {
+				ranges = append(ranges, formatHostNumber(s.numbers[i], s.width))
+			} else {
+				ranges = append(ranges, formatHostNumber(s.numbers[i], s.width)+"-"+formatHostNumber(s.numbers[j], s.width))
+			}
+			i = j + 1
+		}
+		parts = append(parts, fmt.Sprintf("%s[%s]%s", s.prefix, strings.Join(ranges, ","), s.suffix))
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitHostNumber splits host around the last run of digits in its name,
+// ignoring a trailing :port.
+func splitHostNumber(host string) (prefix, digits, suffix string) {
+	name, port := host, ""
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		if _, err := strconv.Atoi(host[idx+1:]); err == nil {
+			name, port = host[:idx], host[idx:]
+		}
+	}
+	end := strings.LastIndexFunc(name, unicode.IsDigit)
+	if end == -1 {
+		return host, "", ""
+	}
+	start := end
+	for start > 0 && unicode.IsDigit(rune(name[start-1])) {
+		start--
+	}
+	return name[:start], name[start : end+1], name[end+1:] + port
+}
+
+func formatHostNumber(n, width int) string {
+	return fmt.Sprintf("%0*d", width, n)
+}
@@ -0,0 +1,88 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ncode/pretty/internal/jobs"
+)
+
+func TestCompressHosts(t *testing.T) {
+	cases := []struct {
+		hosts []string
+		want  string
+	}{
+		{[]string{"web01:22", "web02:22", "web03:22", "web05:22"}, "web[01-03,05]:22"},
+		{[]string{"web9", "web10", "web11"}, "web[9-11]"},
+		{[]string{"db1:22", "web2:22", "db2:22"}, "db[1-2]:22,web2:22"},
+		{[]string{"web1:22", "web1:2222"}, "web1:22,web1:2222"},
+		{[]string{"bastion:22", "rack1-node03", "rack1-node04"}, "bastion:22,rack1-node[03-04]"},
+		{[]string{"10.0.0.1:22", "10.0.0.2:22"}, "10.0.0.[1-2]:22"},
+		{[]string{"web1"}, "web1"},
+	}
+	for _, tc := range cases {
+		if got := compressHosts(tc.hosts); got != tc.want {
+			t.Fatalf("compressHosts(%v) = %q, want %q", tc.hosts, got, tc.want)
+		}
+	}
+}
+
+func TestCollapseLinesGroupsIdenticalOutput(t *testing.T) {
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeAsync, "uname", []string{"web01:22", "web02:22", "web03:22", "web04:22"})
+	outputs := newJobOutputs(100, nil)
+	for _, host := range []string{"web01:22", "web02:22", "web04:22"} {
+		outputs.Append(job.ID, host, "Linux")
+		outputs.Append(job.ID, host, "x86_64")
+	}
+	outputs.Append(job.ID, "web03:22", "Darwin")
+
+	got := collapseLines(manager.Job(job.ID), outputs)
+	want := []string{
+		"job 1 [async] uname: 2 distinct outputs from 4 hosts",
+		collapseSeparator, "web[01-02,04]:22 (3)", collapseSeparator,
+		"Linux", "x86_64",
+		collapseSeparator, "web03:22 (1)", collapseSeparator,
+		"Darwin",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected collapse:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestCollapseLinesMarksMissingAndTruncatedOutput(t *testing.T) {
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeNormal, "true", []string{"host1", "host2"})
+	outputs := newJobOutputs(1, nil)
+	outputs.Append(job.ID, "host1", "one")
+	outputs.Append(job.ID, "host1", "two")
+
+	got := collapseLines(manager.Job(job.ID), outputs)
+	want := []string{
+		"job 1 [normal] true: 2 distinct outputs from 2 hosts",
+		"output truncated after 1 lines",
+		collapseSeparator, "host1 (1)", collapseSeparator,
+		"one",
+		collapseSeparator, "host2 (1)", collapseSeparator,
+		"(no output)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected collapse:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestJobOutputsDropsJobsNoLongerKept(t *testing.T) {
+	kept := map[int]bool{1: true, 2: true}
+	outputs := newJobOutputs(100, func(jobID int) bool { return kept[jobID] })
+	outputs.Append(1, "host1", "first")
+	outputs.Append(0, "host1", "untagged")
+	delete(kept, 1)
+	outputs.Append(2, "host1", "second")
+
+	if got := outputs.Host(1, "host1"); got != nil {
+		t.Fatalf("expected job 1 output to be dropped, got %#v", got)
+	}
+	if got := outputs.Host(2, "host1"); len(got) != 1 || got[0] != "second" {
+		t.Fatalf("unexpected job 2 output: %#v", got)
+	}
+}
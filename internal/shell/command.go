@@ -2,7 +2,12 @@ package shell
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ncode/pretty/internal/sshConn"
 )
 
 type CommandKind int
@@ -15,12 +20,26 @@ const (
 	CommandHelp
 	CommandScroll
 	CommandExit
+	CommandOn
+	CommandSelect
+	CommandDeselect
+	CommandReconnect
+	CommandRolling
+	CommandCollapse
+	CommandDiff
+	CommandStream
+	CommandFilter
+	// CommandInvalid carries a usage or parse error in Arg.
+	CommandInvalid
 )
 
 type Command struct {
-	Kind  CommandKind
-	Arg   string
-	JobID int
+	Kind    CommandKind
+	Arg     string
+	JobID   int
+	Target  string
+	Timeout time.Duration
+	Rolling RollingOptions
 }
 
 func ParseCommand(line string) Command {
@@ -42,9 +61,130 @@ func ParseCommand(line string) Command {
 			return Command{Kind: CommandStatus, JobID: id}
 		}
 		return Command{Kind: CommandStatus}
+	case trimmed == ":collapse" || strings.HasPrefix(trimmed, ":collapse "):
+		return Command{Kind: CommandCollapse, JobID: parseJobID(strings.TrimPrefix(trimmed, ":collapse"))}
+	case trimmed == ":diff" || strings.HasPrefix(trimmed, ":diff "):
+		parts := strings.Fields(strings.TrimPrefix(trimmed, ":diff"))
+		if len(parts) == 0 || len(parts) > 2 {
+			return Command{Kind: CommandInvalid, Arg: "usage: :diff <job-id> [baseline-host]"}
+		}
+		command := Command{Kind: CommandDiff, JobID: parseJobID(parts[0])}
+		if command.JobID <= 0 {
+			return Command{Kind: CommandInvalid, Arg: fmt.Sprintf("invalid job id %q", parts[0])}
+		}
+		if len(parts) == 2 {
+			command.Target = parts[1]
+		}
+		return command
+	case trimmed == ":filter" || strings.HasPrefix(trimmed, ":filter "):
+		return Command{Kind: CommandFilter, Arg: strings.TrimSpace(strings.TrimPrefix(trimmed, ":filter"))}
+	case trimmed == ":stream" || strings.HasPrefix(trimmed, ":stream "):
+		return Command{Kind: CommandStream, Arg: strings.TrimSpace(strings.TrimPrefix(trimmed, ":stream"))}
+	case trimmed == ":timeout" || strings.HasPrefix(trimmed, ":timeout "):
+		return parseTimeout(strings.TrimSpace(strings.TrimPrefix(trimmed, ":timeout")))
+	case trimmed == ":on" || strings.HasPrefix(trimmed, ":on "):
+		target, arg := splitTarget(strings.TrimSpace(strings.TrimPrefix(trimmed, ":on")))
+		return Command{Kind: CommandOn, Target: target, Arg: arg}
+	case trimmed == ":select" || strings.HasPrefix(trimmed, ":select "):
+		return Command{Kind: CommandSelect, Arg: strings.TrimSpace(strings.TrimPrefix(trimmed, ":select"))}
+	case trimmed == ":deselect" || strings.HasPrefix(trimmed, ":deselect "):
+		return Command{Kind: CommandDeselect, Arg: strings.TrimSpace(strings.TrimPrefix(trimmed, ":deselect"))}
+	case trimmed == ":reconnect" || strings.HasPrefix(trimmed, ":reconnect "):
+		return Command{Kind: CommandReconnect, Target: strings.TrimSpace(strings.TrimPrefix(trimmed, ":reconnect"))}
+	case trimmed == ":rolling" || strings.HasPrefix(trimmed, ":rolling "):
+		return parseRolling(strings.TrimSpace(strings.TrimPrefix(trimmed, ":rolling")))
 	case strings.HasPrefix(trimmed, ":async"):
 		return Command{Kind: CommandAsync, Arg: strings.TrimSpace(strings.TrimPrefix(trimmed, ":async"))}
 	default:
 		return Command{Kind: CommandRun, Arg: trimmed}
 	}
 }
+
+// parseJobID parses an optional job ID argument; zero means none was given.
+func parseJobID(arg string) int {
+	var id int
+	_, _ = fmt.Sscanf(strings.TrimSpace(arg), "%d", &id)
+	return id
+}
+
+// splitTarget splits "<target> <command>" where target is either a comma
+// separated host list or a /regex/ that may itself contain spaces.
+func splitTarget(rest string) (string, string) {
+	if strings.HasPrefix(rest, "/") {
+		if end := strings.Index(rest[1:], "/"); end != -1 {
+			return rest[:end+2], strings.TrimSpace(rest[end+2:])
+		}
+		return rest, ""
+	}
+	idx := strings.IndexFunc(rest, unicode.IsSpace)
+	if idx == -1 {
+		return rest, ""
+	}
+	return rest[:idx], strings.TrimSpace(rest[idx:])
+}
+
+// parseTimeout handles ":timeout <duration> <command>", where command may be a
+// plain command, ":async ...", ":on ..." or ":rolling ...".
+func parseTimeout(rest string) Command {
+	durationArg, commandArg := rest, ""
+	if idx := strings.IndexFunc(rest, unicode.IsSpace); idx != -1 {
+		durationArg, commandArg = rest[:idx], strings.TrimSpace(rest[idx:])
+	}
+	if durationArg == "" || commandArg == "" {
+		return Command{Kind: CommandInvalid, Arg: "usage: :timeout <duration> <command>"}
+	}
+	timeout, err := sshConn.ParseSSHDuration(durationArg)
+	if err != nil || timeout == 0 {
+		return Command{Kind: CommandInvalid, Arg: fmt.Sprintf("invalid timeout %q", durationArg)}
+	}
+	command := ParseCommand(commandArg)
+	switch command.Kind {
+	case CommandRun, CommandAsync, CommandOn, CommandRolling:
+		command.Timeout = timeout
+		return command
+	case CommandInvalid:
+		return command
+	default:
+		return Command{Kind: CommandInvalid, Arg: ":timeout only applies to commands, :async, :on and :rolling"}
+	}
+}
+
+// parseRolling handles ":rolling [--batch N] [--max-fail N] <command>". Both
+// flags default to 1, so a bare ":rolling" runs one host at a time and stops
+// at the first failure.
+func parseRolling(rest string) Command {
+	const usage = "usage: :rolling [--batch N] [--max-fail N] <command>"
+	options := RollingOptions{Batch: 1, MaxFail: 1}
+	for strings.HasPrefix(rest, "--") {
+		flag, remainder := cutField(rest)
+		name, value, hasValue := strings.Cut(flag, "=")
+		if !hasValue {
+			value, remainder = cutField(remainder)
+		}
+		n, err := strconv.Atoi(value)
+		switch {
+		case name != "--batch" && name != "--max-fail":
+			return Command{Kind: CommandInvalid, Arg: fmt.Sprintf("unknown :rolling flag %q", name)}
+		case err != nil || n < 0 || (name == "--batch" && n == 0):
+			return Command{Kind: CommandInvalid, Arg: fmt.Sprintf("invalid %s %q", name, value)}
+		case name == "--batch":
+			options.Batch = n
+		default:
+			options.MaxFail = n
+		}
+		rest = remainder
+	}
+	if rest == "" {
+		return Command{Kind: CommandInvalid, Arg: usage}
+	}
+	return Command{Kind: CommandRolling, Arg: rest, Rolling: options}
+}
+
+// cutField splits the first whitespace separated field off s.
+func cutField(s string) (string, string) {
+	idx := strings.IndexFunc(s, unicode.IsSpace)
+	if idx == -1 {
+		return s, ""
+	}
+	return s[:idx], strings.TrimSpace(s[idx:])
+}
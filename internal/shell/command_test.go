@@ -1,6 +1,9 @@
 package shell
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestParseCommandAsync(t *testing.T) {
 	cmd := ParseCommand(":async uptime")
@@ -22,3 +25,137 @@ func TestParseCommandDefault(t *testing.T) {
 		t.Fatalf("unexpected: %+v", cmd)
 	}
 }
+
+func TestParseCommandOnHostList(t *testing.T) {
+	cmd := ParseCommand(":on web1,web3 systemctl restart nginx")
+	if cmd.Kind != CommandOn || cmd.Target != "web1,web3" || cmd.Arg != "systemctl restart nginx" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandOnRegexWithSpaces(t *testing.T) {
+	cmd := ParseCommand(":on /web[13]|db 2/ uptime")
+	if cmd.Kind != CommandOn || cmd.Target != "/web[13]|db 2/" || cmd.Arg != "uptime" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandOnMissingCommand(t *testing.T) {
+	cmd := ParseCommand(":on web1")
+	if cmd.Kind != CommandOn || cmd.Target != "web1" || cmd.Arg != "" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandSelectAndDeselect(t *testing.T) {
+	cmd := ParseCommand(":select group:web")
+	if cmd.Kind != CommandSelect || cmd.Arg != "group:web" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	cmd = ParseCommand(":deselect web2")
+	if cmd.Kind != CommandDeselect || cmd.Arg != "web2" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandReconnect(t *testing.T) {
+	cmd := ParseCommand(":reconnect")
+	if cmd.Kind != CommandReconnect || cmd.Target != "" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	cmd = ParseCommand(":reconnect web1")
+	if cmd.Kind != CommandReconnect || cmd.Target != "web1" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandTimeout(t *testing.T) {
+	cmd := ParseCommand(":timeout 30s uptime")
+	if cmd.Kind != CommandRun || cmd.Arg != "uptime" || cmd.Timeout != 30*time.Second {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	cmd = ParseCommand(":timeout 5 :async sleep 10")
+	if cmd.Kind != CommandAsync || cmd.Arg != "sleep 10" || cmd.Timeout != 5*time.Second {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	cmd = ParseCommand(":timeout 1m :on web1 uptime")
+	if cmd.Kind != CommandOn || cmd.Target != "web1" || cmd.Timeout != time.Minute {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandTimeoutInvalid(t *testing.T) {
+	for _, input := range []string{":timeout", ":timeout 30s", ":timeout soon uptime", ":timeout 0 uptime", ":timeout 5s :status"} {
+		if cmd := ParseCommand(input); cmd.Kind != CommandInvalid || cmd.Arg == "" {
+			t.Fatalf("expected invalid command for %q, got %+v", input, cmd)
+		}
+	}
+}
+
+func TestParseCommandRolling(t *testing.T) {
+	cmd := ParseCommand(":rolling --batch 5 --max-fail=2 ./deploy.sh --force")
+	if cmd.Kind != CommandRolling || cmd.Arg != "./deploy.sh --force" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	if cmd.Rolling.Batch != 5 || cmd.Rolling.MaxFail != 2 {
+		t.Fatalf("unexpected options: %+v", cmd.Rolling)
+	}
+	cmd = ParseCommand(":rolling uptime")
+	if cmd.Kind != CommandRolling || cmd.Rolling.Batch != 1 || cmd.Rolling.MaxFail != 1 {
+		t.Fatalf("unexpected defaults: %+v", cmd)
+	}
+	cmd = ParseCommand(":timeout 1m :rolling --batch 2 uptime")
+	if cmd.Kind != CommandRolling || cmd.Timeout != time.Minute || cmd.Rolling.Batch != 2 {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandRollingInvalid(t *testing.T) {
+	for _, input := range []string{":rolling", ":rolling --batch 5", ":rolling --batch 0 uptime", ":rolling --max-fail -1 uptime", ":rolling --forks 2 uptime"} {
+		if cmd := ParseCommand(input); cmd.Kind != CommandInvalid {
+			t.Fatalf("expected invalid command for %q, got %+v", input, cmd)
+		}
+	}
+}
+
+func TestParseCommandCollapse(t *testing.T) {
+	if cmd := ParseCommand(":collapse"); cmd.Kind != CommandCollapse || cmd.JobID != 0 {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	if cmd := ParseCommand(":collapse 7"); cmd.Kind != CommandCollapse || cmd.JobID != 7 {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandStream(t *testing.T) {
+	if cmd := ParseCommand(":stream"); cmd.Kind != CommandStream || cmd.Arg != "" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	if cmd := ParseCommand(":stream stdout,stderr"); cmd.Kind != CommandStream || cmd.Arg != "stdout,stderr" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandFilter(t *testing.T) {
+	if cmd := ParseCommand(":filter host=web* grep=ERROR"); cmd.Kind != CommandFilter || cmd.Arg != "host=web* grep=ERROR" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	if cmd := ParseCommand(":filter"); cmd.Kind != CommandFilter || cmd.Arg != "" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+}
+
+func TestParseCommandDiff(t *testing.T) {
+	cmd := ParseCommand(":diff 3 web1")
+	if cmd.Kind != CommandDiff || cmd.JobID != 3 || cmd.Target != "web1" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	if cmd := ParseCommand(":diff 3"); cmd.Kind != CommandDiff || cmd.Target != "" {
+		t.Fatalf("unexpected: %+v", cmd)
+	}
+	for _, input := range []string{":diff", ":diff web1", ":diff 3 web1 web2"} {
+		if cmd := ParseCommand(input); cmd.Kind != CommandInvalid {
+			t.Fatalf("expected invalid command for %q, got %+v", input, cmd)
+		}
+	}
+}
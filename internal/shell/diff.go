@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/ncode/pretty/internal/jobs"
+)
+
+// diffLines renders a unified diff of the captured output of every host of
+// job against baseline. An empty baseline picks the host with the most common
+// output, the first such host in job order on ties. Each host's diff is
+// colored with colorize.
+func diffLines(job *jobs.Job, outputs *jobOutputs, baseline string, colorize hostLineColorizer) ([]string, error) {
+	if job == nil {
+		return nil, fmt.Errorf("job not found")
+	}
+	for _, host := range job.HostsOrder {
+		if jobHostPending(job, host) {
+			return nil, fmt.Errorf("job %d is still running", job.ID)
+		}
+	}
+
+	texts := make(map[string]string, len(job.HostsOrder))
+	counts := make(map[string]int)
+	for _, host := range job.HostsOrder {
+		lines := outputs.Host(job.ID, host)
+		text := ""
+		if len(lines) > 0 {
+			text = strings.Join(lines, "\n") + "\n"
+		}
+		texts[host] = text
+		counts[text]++
+	}
+
+	reason := ""
+	if baseline == "" {
+		reason = " (most common output)"
+		for _, host := range job.HostsOrder {
+			if baseline == "" || counts[texts[host]] > counts[texts[baseline]] {
+				baseline = host
+			}
+		}
+	} else if _, ok := job.Hosts[baseline]; !ok {
+		return nil, fmt.Errorf("%s is not part of job %d", baseline, job.ID)
+	}
+
+	out := []string{fmt.Sprintf("job %d [%s] %s: diff against %s%s", job.ID, job.Type, job.Command, baseline, reason)}
+	if outputs.Truncated(job.ID) {
+		out = append(out, fmt.Sprintf("output truncated after %d lines", outputs.maxLines))
+	}
+	identical := 0
+	for _, host := range job.HostsOrder {
+		if host == baseline {
+			continue
+		}
+		if texts[host] == texts[baseline] {
+			identical++
+			continue
+		}
+		diff := udiff.Unified(baseline, host, texts[baseline], texts[host])
+		for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+			if colorize != nil {
+				line = colorize(host, line)
+			}
+			out = append(out, line)
+		}
+	}
+	out = append(out, fmt.Sprintf("%d of %d hosts identical to %s", identical, len(job.HostsOrder)-1, baseline))
+	return out, nil
+}
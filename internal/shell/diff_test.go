@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ncode/pretty/internal/jobs"
+)
+
+func finishedJob(manager *jobs.Manager, command string, hosts ...string) *jobs.Job {
+	job := manager.CreateJob(jobs.JobTypeAsync, command, hosts)
+	for _, host := range hosts {
+		manager.MarkHostDone(job.ID, host, 0, true)
+	}
+	return manager.Job(job.ID)
+}
+
+func TestDiffLinesUsesMostCommonOutputAsBaseline(t *testing.T) {
+	manager := jobs.NewManager()
+	job := finishedJob(manager, "cat /etc/ntp.conf", "host1", "host2", "host3")
+	outputs := newJobOutputs(100, nil)
+	outputs.Append(job.ID, "host1", "server a")
+	outputs.Append(job.ID, "host1", "server c")
+	for _, host := range []string{"host2", "host3"} {
+		outputs.Append(job.ID, host, "server a")
+		outputs.Append(job.ID, host, "server b")
+	}
+
+	colorize := func(hostname, line string) string { return hostname + "|" + line }
+	got, err := diffLines(job, outputs, "", colorize)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"job 1 [async] cat /etc/ntp.conf: diff against host2 (most common output)",
+		"host1|--- host2",
+		"host1|+++ host1",
+		"host1|@@ -1,2 +1,2 @@",
+		"host1| server a",
+		"host1|-server b",
+		"host1|+server c",
+		"1 of 2 hosts identical to host2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected diff:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDiffLinesExplicitBaseline(t *testing.T) {
+	manager := jobs.NewManager()
+	job := finishedJob(manager, "hostname", "host1", "host2")
+	outputs := newJobOutputs(100, nil)
+	outputs.Append(job.ID, "host1", "host1")
+
+	got, err := diffLines(job, outputs, "host1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"job 1 [async] hostname: diff against host1",
+		"--- host1",
+		"+++ host2",
+		"@@ -1 +0,0 @@",
+		"-host1",
+		"0 of 1 hosts identical to host1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected diff:\n got %#v\nwant %#v", got, want)
+	}
+	if _, err := diffLines(job, outputs, "host9", nil); err == nil {
+		t.Fatal("expected error for baseline outside the job")
+	}
+}
+
+func TestDiffLinesRejectsRunningJob(t *testing.T) {
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeNormal, "uptime", []string{"host1"})
+	manager.MarkHostRunning(job.ID, "host1")
+
+	_, err := diffLines(manager.Job(job.ID), newJobOutputs(100, nil), "", nil)
+	if err == nil || err.Error() != "job 1 is still running" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// Output formats for a batch run.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// ExecOptions tunes a batch run.
+type ExecOptions struct {
+	// Rolling spreads the run over waves of hosts; the zero value runs every
+	// host at once and never aborts.
+	Rolling RollingOptions
+	// Collapse holds host stdout back and prints it grouped by identical
+	// output once every host has finished, as `:collapse` does. Remote stderr
+	// and system messages still stream to stderr as they arrive.
+	Collapse bool
+	// Output is OutputText, the default when empty, or OutputJSON for one
+	// NDJSON record per output line plus one result record per host.
+	Output string
+	// Streams limits the printed lines to these streams, such as "stdout" or
+	// "stderr"; empty or "all" prints every stream. The output log and
+	// `--collapse` are not affected.
+	Streams []string
+}
+
+// outputRecord is the NDJSON record for one line of output.
+type outputRecord struct {
+	Type   string    `json:"type"`
+	JobID  int       `json:"job_id"`
+	Host   string    `json:"host"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+	Time   time.Time `json:"ts"`
+}
+
+// resultRecord is the final NDJSON record for one host.
+type resultRecord struct {
+	Type  string `json:"type"`
+	JobID int    `json:"job_id"`
+	hostResult
+}
+
+// Exec runs command once on every host in hostList, each over its own SSH
+// session, and waits for all of them to finish. Host output is streamed to
+// stdout with the usual host prefix, remote stderr goes to stderr with the
+// same prefix and system messages go to stderr as they are. Once every host
+// is done a per-host summary, formatted like `:status`, is written to stderr.
+// With OutputJSON every line, system messages included, and the per-host
+// results are written to stdout as NDJSON instead. A non-nil error is returned
+// when any host failed or exceeded the configured timeout.
+func Exec(hostList *sshConn.HostList, command string, options ExecOptions, stdout, stderr io.Writer) error {
+	if hostList == nil || hostList.Len() == 0 {
+		return fmt.Errorf("no hosts configured")
+	}
+	switch options.Output {
+	case "", OutputText:
+	case OutputJSON:
+		if options.Collapse {
+			return fmt.Errorf("--collapse cannot be combined with --output %s", OutputJSON)
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", options.Output)
+	}
+	streams, err := parseStreams(options.Streams)
+	if err != nil {
+		return err
+	}
+	hosts := hostList.Hosts()
+	if err := checkCommandTemplate(hosts, command); err != nil {
+		return err
+	}
+	hostColors := make(map[string]*color.Color, len(hosts))
+	for _, host := range hosts {
+		hostColors[host.Hostname] = host.Color
+	}
+
+	timeout, err := timeoutFromConfig()
+	if err != nil {
+		return err
+	}
+	concurrency, err := concurrencyFromConfig()
+	if err != nil {
+		return err
+	}
+
+	manager := jobs.NewManager()
+	jobType := jobs.JobTypeAsync
+	if options.Rolling.Batch > 0 {
+		jobType = jobs.JobTypeRolling
+	}
+	job := manager.CreateJob(jobType, command, hostnames(hosts))
+
+	outputs := newJobOutputs(maxOutputLines, nil)
+	outputLog := outputLogFromConfig()
+	defer outputLog.Close()
+	if outputLog != nil {
+		fmt.Fprintf(stderr, "writing job output to %s\n", outputLog.Dir())
+	}
+	encoder := json.NewEncoder(stdout)
+	events := make(chan sshConn.OutputEvent, outputBufferSize(len(hosts)))
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		for evt := range events {
+			if err := outputLog.Write(evt); err != nil {
+				fmt.Fprintln(stderr, err)
+			}
+			if options.Collapse {
+				outputs.AppendEvent(evt)
+			}
+			if streams != nil && !streams[evt.Stream] {
+				continue
+			}
+			switch {
+			case options.Output == OutputJSON:
+				encoder.Encode(outputRecord{
+					Type:   "output",
+					JobID:  evt.JobID,
+					Host:   evt.Hostname,
+					Stream: evt.Stream.String(),
+					Line:   evt.Line,
+					Time:   eventTime(evt),
+				})
+			case evt.Stream != sshConn.StreamStdout:
+				fmt.Fprintln(stderr, formatEvent(hostColors, evt))
+			case !options.Collapse:
+				fmt.Fprintln(stdout, formatEvent(hostColors, evt))
+			}
+		}
+	}()
+
+	runRolling(manager, job.ID, hosts, command, options.Rolling, timeout, newForks(concurrency), events)
+	close(events)
+	<-printed
+
+	summary := manager.Job(job.ID)
+	if err := outputLog.WriteSummary(summary); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	if options.Collapse {
+		for _, line := range collapseLines(summary, outputs) {
+			fmt.Fprintln(stdout, line)
+		}
+	}
+	if options.Output == OutputJSON {
+		for _, result := range hostResults(summary) {
+			encoder.Encode(resultRecord{Type: "result", JobID: summary.ID, hostResult: result})
+		}
+	} else {
+		for _, line := range formatJob(summary, func(hostname, line string) string {
+			return colorizeHostLine(hostColors, hostname, line)
+		}) {
+			fmt.Fprintln(stderr, line)
+		}
+	}
+
+	failed, skipped := 0, 0
+	for _, status := range summary.Hosts {
+		switch status.State {
+		case jobs.HostSuccess:
+		case jobs.HostSkipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+	if skipped > 0 {
+		return fmt.Errorf("command failed on %d of %d hosts, %d skipped", failed, len(hosts), skipped)
+	}
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d hosts", failed, len(hosts))
+	}
+	return nil
+}
+
+// eventTime returns when evt was produced, in UTC, or the current time for
+// events built without one.
+func eventTime(evt sshConn.OutputEvent) time.Time {
+	if evt.Time.IsZero() {
+		return time.Now().UTC()
+	}
+	return evt.Time.UTC()
+}
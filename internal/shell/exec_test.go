@@ -0,0 +1,315 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/viper"
+)
+
+func TestExecStreamsOutputAndSummarizes(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "up"}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "uptime", ExecOptions{}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "host1: up") || !strings.Contains(out, "host2: up") {
+		t.Fatalf("expected prefixed output, got %q", out)
+	}
+	summary := stderr.String()
+	if !strings.Contains(summary, "job 1 [async] uptime") {
+		t.Fatalf("expected job header in summary, got %q", summary)
+	}
+	if !strings.Contains(summary, "host1: succeeded exit=0") || !strings.Contains(summary, "host2: succeeded exit=0") {
+		t.Fatalf("expected host results in summary, got %q", summary)
+	}
+}
+
+func TestExecReturnsErrorWhenAnyHostFails(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		if host.Hostname == "host2" {
+			events <- sshConn.OutputEvent{Hostname: host.Hostname, Line: "boom", Stream: sshConn.StreamSystem}
+			return 2, nil
+		}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2"})
+
+	var stdout, stderr bytes.Buffer
+	err := Exec(hostList, "false", ExecOptions{}, &stdout, &stderr)
+	if err == nil || err.Error() != "command failed on 1 of 2 hosts" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "boom") {
+		t.Fatalf("expected system line on stderr, got %q", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "host2: failed exit=2") {
+		t.Fatalf("expected failed host in summary, got %q", stderr.String())
+	}
+}
+
+func TestExecNoHosts(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := Exec(sshConn.NewHostList(), "uptime", ExecOptions{}, &stdout, &stderr); err == nil {
+		t.Fatal("expected error for empty host list")
+	}
+}
+
+func TestExecRollingSkipsAfterMaxFail(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		return 1, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2"})
+	hostList.AddHost(&sshConn.Host{Hostname: "host3"})
+
+	var stdout, stderr bytes.Buffer
+	err := Exec(hostList, "./deploy.sh", ExecOptions{Rolling: RollingOptions{Batch: 1, MaxFail: 1}}, &stdout, &stderr)
+	if err == nil || err.Error() != "command failed on 1 of 3 hosts, 2 skipped" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	summary := stderr.String()
+	if !strings.Contains(summary, "job 1 [rolling] ./deploy.sh") || !strings.Contains(summary, "host3: skipped") {
+		t.Fatalf("expected rolling summary, got %q", summary)
+	}
+}
+
+func TestExecCollapsePrintsGroupedOutput(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "ok"}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22"})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "check", ExecOptions{Collapse: true}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "job 1 [async] check: 1 distinct outputs from 2 hosts\n" +
+		collapseSeparator + "\nweb[1-2]:22 (2)\n" + collapseSeparator + "\nok\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected collapsed output:\n%s", stdout.String())
+	}
+}
+
+func TestExecWritesOutputDir(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+	viper.Reset()
+	defer viper.Reset()
+	dir := t.TempDir()
+	viper.Set("output_dir", dir)
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "up"}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1:22"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "uptime", ExecOptions{}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	runs, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run directory, got %v (%v)", runs, err)
+	}
+	if !strings.Contains(stderr.String(), "writing job output to "+runs[0]) {
+		t.Fatalf("expected the run directory on stderr, got %q", stderr.String())
+	}
+	if got := readFile(t, filepath.Join(runs[0], "1", "host1_22.out")); got != "up\n" {
+		t.Fatalf("unexpected .out: %q", got)
+	}
+	if got := readFile(t, filepath.Join(runs[0], "1", "summary.json")); !strings.Contains(got, `"state": "succeeded"`) {
+		t.Fatalf("unexpected summary: %s", got)
+	}
+}
+
+func TestExecJSONEmitsRecords(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "up"}
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "warn", Stream: sshConn.StreamStderr}
+		return 2, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1:22", Color: color.New(color.FgRed)})
+
+	var stdout, stderr bytes.Buffer
+	err := Exec(hostList, "uptime", ExecOptions{Output: OutputJSON}, &stdout, &stderr)
+	if err == nil {
+		t.Fatal("expected error for failed host")
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("expected nothing on stderr, got %q", stderr.String())
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d: %s", len(records), stdout.String())
+	}
+	if records[0]["type"] != "output" || records[0]["stream"] != "stdout" || records[0]["line"] != "up" || records[0]["host"] != "host1:22" {
+		t.Fatalf("unexpected stdout record: %v", records[0])
+	}
+	if _, ok := records[0]["ts"].(string); !ok {
+		t.Fatalf("expected ts on output record: %v", records[0])
+	}
+	if records[1]["stream"] != "stderr" || records[1]["line"] != "warn" {
+		t.Fatalf("unexpected stderr record: %v", records[1])
+	}
+	result := records[2]
+	if result["type"] != "result" || result["job_id"] != float64(1) || result["state"] != "failed" || result["exit_code"] != float64(2) {
+		t.Fatalf("unexpected result record: %v", result)
+	}
+	if _, ok := result["duration"].(float64); !ok {
+		t.Fatalf("expected numeric duration: %v", result)
+	}
+}
+
+func TestExecJSONUsesEventTime(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	produced := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "up", Time: produced}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1:22"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "uptime", ExecOptions{Output: OutputJSON}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var record outputRecord
+	first, _, _ := strings.Cut(stdout.String(), "\n")
+	if err := json.Unmarshal([]byte(first), &record); err != nil {
+		t.Fatalf("invalid NDJSON line %q: %v", first, err)
+	}
+	if !record.Time.Equal(produced) {
+		t.Fatalf("expected ts %v from the event, got %v", produced, record.Time)
+	}
+}
+
+func TestExecStreams(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "up"}
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "warn", Stream: sshConn.StreamStderr}
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1:22"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "uptime", ExecOptions{}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "host1:22: up\n" {
+		t.Fatalf("unexpected stdout %q", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "host1:22: warn\n") {
+		t.Fatalf("expected prefixed stderr, got %q", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if err := Exec(hostList, "uptime", ExecOptions{Streams: []string{"stderr"}}, &stdout, &stderr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Fatalf("expected stdout filtered out, got %q", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "host1:22: warn\n") {
+		t.Fatalf("expected stderr kept, got %q", stderr.String())
+	}
+
+	if err := Exec(hostList, "uptime", ExecOptions{Streams: []string{"stdin"}}, &stdout, &stderr); err == nil || err.Error() != `unknown stream "stdin"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestExecRejectsUnknownOutput(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+
+	var stdout, stderr bytes.Buffer
+	if err := Exec(hostList, "uptime", ExecOptions{Output: "yaml"}, &stdout, &stderr); err == nil || err.Error() != `unknown output format "yaml"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Exec(hostList, "uptime", ExecOptions{Output: OutputJSON, Collapse: true}, &stdout, &stderr); err == nil {
+		t.Fatal("expected error combining --collapse with json output")
+	}
+}
+
+func TestExecRejectsTemplateMissingTagBeforeRunning(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		t.Fatalf("unexpected run on %s", host.Hostname)
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1", Tags: map[string]string{"role": "web"}})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2"})
+
+	var stdout, stderr bytes.Buffer
+	err := Exec(hostList, "restart {{.Tags.role}}", ExecOptions{}, &stdout, &stderr)
+	if err == nil || !strings.HasPrefix(err.Error(), "host2: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
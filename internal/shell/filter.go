@@ -0,0 +1,122 @@
+package shell
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// outputFilter limits the viewport to host output matching a host glob and a
+// regular expression, as set with `:filter host=web* grep=ERROR`. Lines that
+// do not come from a host, such as command feedback, are always shown.
+type outputFilter struct {
+	host string
+	grep *regexp.Regexp
+}
+
+// parseOutputFilter parses the arguments of `:filter`. "off" returns nil.
+func parseOutputFilter(arg string) (*outputFilter, error) {
+	if strings.TrimSpace(arg) == "off" {
+		return nil, nil
+	}
+	filter := &outputFilter{}
+	for _, field := range strings.Fields(arg) {
+		key, value, _ := strings.Cut(field, "=")
+		if value == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected host=<glob> or grep=<regex>", field)
+		}
+		switch key {
+		case "host":
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid host pattern %q: %w", value, err)
+			}
+			filter.host = value
+		case "grep":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid grep pattern %q: %w", value, err)
+			}
+			filter.grep = re
+		default:
+			return nil, fmt.Errorf("invalid filter %q, expected host=<glob> or grep=<regex>", field)
+		}
+	}
+	if filter.host == "" && filter.grep == nil {
+		return nil, fmt.Errorf("usage: :filter [host=<glob>] [grep=<regex>] | off")
+	}
+	return filter, nil
+}
+
+// match reports whether line passes the filter. The host glob is tried
+// against the host with and without its port.
+func (f *outputFilter) match(line outputLine) bool {
+	if line.host == "" {
+		return true
+	}
+	if f.host != "" && !matchHostGlob(f.host, line.host) {
+		return false
+	}
+	return f.grep == nil || f.grep.MatchString(line.line)
+}
+
+func (f *outputFilter) String() string {
+	parts := make([]string, 0, 2)
+	if f.host != "" {
+		parts = append(parts, "host="+f.host)
+	}
+	if f.grep != nil {
+		parts = append(parts, "grep="+f.grep.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+func matchHostGlob(pattern, host string) bool {
+	if ok, _ := path.Match(pattern, host); ok {
+		return true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	return false
+}
+
+// searchLines returns the index of the next line matching re, starting at from
+// and moving forward or backward, wrapping around the ends. Colors are ignored.
+// It returns -1 when no line matches.
+func searchLines(lines []string, re *regexp.Regexp, from int, forward bool) int {
+	n := len(lines)
+	if n == 0 {
+		return -1
+	}
+	step := 1
+	if !forward {
+		step = -1
+	}
+	from = ((from % n) + n) % n
+	for i := 0; i < n; i++ {
+		idx := ((from+i*step)%n + n) % n
+		if re.MatchString(ansi.Strip(lines[idx])) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// countMatches returns how many lines match re and the 1-based position of
+// line among them.
+func countMatches(lines []string, re *regexp.Regexp, line int) (position, total int) {
+	for i, text := range lines {
+		if re.MatchString(ansi.Strip(text)) {
+			total++
+			if i <= line {
+				position = total
+			}
+		}
+	}
+	return position, total
+}
@@ -0,0 +1,79 @@
+package shell
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseOutputFilter(t *testing.T) {
+	filter, err := parseOutputFilter("host=web* grep=ERROR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter.String() != "host=web* grep=ERROR" {
+		t.Fatalf("unexpected filter %q", filter.String())
+	}
+	if filter, err := parseOutputFilter("off"); err != nil || filter != nil {
+		t.Fatalf("expected nil filter for off, got %v, %v", filter, err)
+	}
+	for _, arg := range []string{"web*", "host=", "user=root", "grep=(", "host=[", ""} {
+		if _, err := parseOutputFilter(arg); err == nil {
+			t.Fatalf("expected error for %q", arg)
+		}
+	}
+}
+
+func TestOutputFilterMatch(t *testing.T) {
+	filter, err := parseOutputFilter("host=web1 grep=^ERROR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		line outputLine
+		want bool
+	}{
+		{outputLine{host: "web1:22", line: "ERROR disk full"}, true},
+		{outputLine{host: "web1:22", line: "ok"}, false},
+		{outputLine{host: "web2:22", line: "ERROR disk full"}, false},
+		{outputLine{line: "3 of 3 hosts selected"}, true},
+	}
+	for _, tc := range cases {
+		if got := filter.match(tc.line); got != tc.want {
+			t.Fatalf("match(%+v) = %t, want %t", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestSearchLinesWraps(t *testing.T) {
+	lines := []string{"ERROR one", "ok", "\x1b[31mERROR\x1b[0m two", "ok"}
+	re := regexp.MustCompile("^ERROR")
+
+	if got := searchLines(lines, re, 1, true); got != 2 {
+		t.Fatalf("expected forward match at 2, got %d", got)
+	}
+	if got := searchLines(lines, re, 3, true); got != 0 {
+		t.Fatalf("expected wrapped match at 0, got %d", got)
+	}
+	if got := searchLines(lines, re, -1, false); got != 2 {
+		t.Fatalf("expected backward match at 2, got %d", got)
+	}
+	if got := searchLines(lines, regexp.MustCompile("missing"), 0, true); got != -1 {
+		t.Fatalf("expected no match, got %d", got)
+	}
+	if position, total := countMatches(lines, re, 2); position != 2 || total != 2 {
+		t.Fatalf("unexpected count %d of %d", position, total)
+	}
+}
+
+func TestOutputBufferFilter(t *testing.T) {
+	buf := newOutputBuffer(10)
+	buf.Append("feedback")
+	buf.AppendHost("web1:22", "ERROR", "web1:22: ERROR")
+	buf.AppendHost("db1:22", "ok", "db1:22: ok")
+
+	got := buf.Filter(func(line outputLine) bool { return line.host != "db1:22" })
+	if want := []string{"feedback", "web1:22: ERROR"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected lines %#v", got)
+	}
+}
@@ -1,8 +1,13 @@
 package shell
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -19,6 +24,11 @@ type outputMsg struct {
 	events []sshConn.OutputEvent
 }
 
+// jobTimeoutMsg fires when a normal job's timeout expires.
+type jobTimeoutMsg struct {
+	jobID int
+}
+
 const (
 	defaultPrompt  = "> "
 	maxOutputLines = 10000
@@ -28,10 +38,20 @@ type model struct {
 	input      textinput.Model
 	viewport   viewport.Model
 	output     *outputBuffer
+	jobOutput  *jobOutputs
+	outputLog  *outputLog
 	quit       bool
 	history    *historyState
 	scrollMode bool
 
+	// searching is set while a `/pattern` is typed in scroll mode. search is
+	// the last pattern, searchLine the line of the current match and
+	// searchStatus the result shown in the scroll status line.
+	searching    bool
+	search       *regexp.Regexp
+	searchLine   int
+	searchStatus string
+
 	lastCtrlCAt time.Time
 	now         func() time.Time
 
@@ -40,11 +60,28 @@ type model struct {
 	jobs       *jobs.Manager
 	broker     chan<- sshConn.CommandRequest
 	events     chan sshConn.OutputEvent
+
+	prompt string
+	// timeout is the default per-command timeout from the `timeout` config
+	// key; zero disables it.
+	timeout time.Duration
+	// forks bounds how many dedicated sessions async and rolling jobs open
+	// at once, from `async_concurrency` or --forks. It is shared by every
+	// job, and nil means no limit.
+	forks chan struct{}
+	// streams holds the streams shown in the viewport; nil shows all.
+	streams map[sshConn.Stream]bool
+	// filter limits the viewport to matching host output; nil shows all.
+	filter *outputFilter
+	// selected holds the Hostnames of the sticky active set chosen with
+	// `:select`/`:deselect`; nil means every host is active.
+	selected map[string]bool
 }
 
 func initialModel(hostList *sshConn.HostList, broker chan<- sshConn.CommandRequest, events chan sshConn.OutputEvent) model {
+	prompt := promptFromConfig()
 	input := textinput.New()
-	input.Prompt = promptFromConfig()
+	input.Prompt = prompt
 	input.Focus()
 
 	vp := viewport.New()
@@ -61,17 +98,44 @@ func initialModel(hostList *sshConn.HostList, broker chan<- sshConn.CommandReque
 		}
 	}
 
+	output := newOutputBuffer(maxOutputLines)
+	manager := jobs.NewManager()
+	outputLog := outputLogFromConfig()
+	if outputLog != nil {
+		output.Append(fmt.Sprintf("writing job output to %s", outputLog.Dir()))
+		manager.OnJobFinished(func(job *jobs.Job) {
+			if err := outputLog.WriteSummary(job); err != nil && events != nil {
+				// This may run inside Update, which drains events, so
+				// never block on the send.
+				go func() { events <- sshConn.OutputEvent{Line: err.Error(), Stream: sshConn.StreamSystem} }()
+			}
+		})
+	}
+	timeout, err := timeoutFromConfig()
+	if err != nil {
+		output.Append(err.Error())
+	}
+	concurrency, err := concurrencyFromConfig()
+	if err != nil {
+		output.Append(err.Error())
+	}
+
 	return model{
 		input:      input,
 		viewport:   vp,
-		output:     newOutputBuffer(maxOutputLines),
+		output:     output,
+		outputLog:  outputLog,
+		jobOutput:  newJobOutputs(maxOutputLines, func(jobID int) bool { return manager.Job(jobID) != nil }),
 		history:    history,
 		now:        time.Now,
 		hostList:   hostList,
 		hostColors: hostColors,
-		jobs:       jobs.NewManager(),
+		jobs:       manager,
 		broker:     broker,
 		events:     events,
+		prompt:     prompt,
+		timeout:    timeout,
+		forks:      newForks(concurrency),
 	}
 }
 
@@ -82,6 +146,29 @@ func promptFromConfig() string {
 	return defaultPrompt
 }
 
+func timeoutFromConfig() (time.Duration, error) {
+	if !viper.IsSet("timeout") {
+		return 0, nil
+	}
+	timeout, err := sshConn.ParseSSHDuration(viper.GetString("timeout"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %v", viper.GetString("timeout"), err)
+	}
+	return timeout, nil
+}
+
+func concurrencyFromConfig() (int, error) {
+	value := strings.TrimSpace(viper.GetString("async_concurrency"))
+	if value == "" {
+		return 0, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 0 {
+		return 0, fmt.Errorf("invalid async_concurrency %q", value)
+	}
+	return concurrency, nil
+}
+
 func (m model) Init() tea.Cmd {
 	return listenOutput(m.events)
 }
@@ -101,6 +188,23 @@ func colorizeHostLine(hostColors map[string]*color.Color, hostname, line string)
 	return hostColor.Sprint(line)
 }
 
+// stderrColor styles remote stderr so it stands out from stdout.
+var stderrColor = color.New(color.FgRed, color.Italic)
+
+// formatEvent renders evt for display: host output behind its colored host
+// prefix, remote stderr additionally in stderrColor, and system messages as
+// they are.
+func formatEvent(hostColors map[string]*color.Color, evt sshConn.OutputEvent) string {
+	switch evt.Stream {
+	case sshConn.StreamSystem:
+		return evt.Line
+	case sshConn.StreamStderr:
+		return colorizeHostLine(hostColors, evt.Hostname, evt.Hostname+":") + " " + stderrColor.Sprint(evt.Line)
+	default:
+		return colorizeHostLine(hostColors, evt.Hostname, fmt.Sprintf("%s: %s", evt.Hostname, evt.Line))
+	}
+}
+
 func listenOutput(events <-chan sshConn.OutputEvent) tea.Cmd {
 	if events == nil {
 		return nil
@@ -130,9 +234,21 @@ func (m *model) appendLines(lines ...string) {
 	m.output.Append(lines...)
 }
 
+// visibleLines returns the lines shown in the viewport.
+func (m *model) visibleLines() []string {
+	if m.filter == nil {
+		return m.output.Lines()
+	}
+	return m.output.Filter(m.filter.match)
+}
+
 func (m *model) flushOutputs() {
 	offset := m.viewport.YOffset()
-	m.viewport.SetContent(m.output.String())
+	if m.filter == nil {
+		m.viewport.SetContent(m.output.String())
+	} else {
+		m.viewport.SetContent(strings.Join(m.visibleLines(), "\n"))
+	}
 	if m.scrollMode {
 		m.viewport.SetYOffset(offset)
 		return
@@ -161,6 +277,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+z":
 			request := sshConn.CommandRequest{Kind: sshConn.CommandKindControl, ControlByte: 0x1a}
 			return m, sendCommand(m.broker, request)
+		case "/":
+			if m.scrollMode && !m.searching {
+				m.searching = true
+				m.input.Prompt = "/"
+				m.input.Reset()
+				m.input.Focus()
+				return m, nil
+			}
+		case "n", "N":
+			if m.scrollMode && !m.searching {
+				m.jumpSearch(msg.String() == "n")
+				return m, nil
+			}
 		case "up":
 			if m.scrollMode {
 				break
@@ -180,6 +309,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 		case "esc":
+			if m.searching {
+				m.endSearchInput()
+				return m, nil
+			}
 			if m.scrollMode {
 				m.scrollMode = false
 				m.input.Focus()
@@ -187,6 +320,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 		case "enter":
+			if m.searching {
+				pattern := m.input.Value()
+				m.endSearchInput()
+				m.startSearch(pattern)
+				return m, nil
+			}
 			line := m.input.Value()
 			trimmed := strings.TrimSpace(line)
 			if trimmed != "" {
@@ -199,6 +338,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			command := ParseCommand(line)
 			if command.Kind == CommandScroll {
 				m.scrollMode = true
+				m.searchStatus = ""
 				m.input.Blur()
 				return m, nil
 			}
@@ -209,10 +349,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Quit
 			case CommandHelp:
 				m.appendOutputs(
-					"commands: :async <command>, :status [id], :list, :help, :scroll, :bye",
+					"commands: :async <command>, :on <hosts|/regex/> <command>, :rolling [--batch N] [--max-fail N] <command>, :status [id], :collapse [id], :diff <id> [host], :stream [stdout,stderr,system|all], :filter [host=<glob>] [grep=<regex>|off], :list, :reconnect [hosts|/regex/], :timeout <duration> <command>, :help, :scroll, :bye",
+					"selection: :select <all|failed|group:<name>|tag:<key=value>|hosts|/regex/>, :deselect <hosts|/regex/|group:<name>|tag:<key=value>>",
 					"history: use Up/Down to navigate previous commands",
 					"keys: Ctrl+C forwards interrupt; double Ctrl+C (500ms) quits; Ctrl+Z forwards suspend",
-					"scroll: :scroll to enter, esc to return (output scroll only in scroll mode)",
+					"scroll: :scroll to enter, / to search, n/N for next/previous match, esc to return (output scroll only in scroll mode)",
 				)
 				return m, nil
 			case CommandList:
@@ -223,6 +364,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				for _, host := range m.hostList.Hosts() {
 					connected := atomic.LoadInt32(&host.IsConnected) == 1
 					line := fmt.Sprintf("%s: Connected(%t)", host.Hostname, connected)
+					if m.selected != nil {
+						line = fmt.Sprintf("%s Selected(%t)", line, m.selected[host.Hostname])
+					}
 					m.appendOutputs(colorizeHostLine(m.hostColors, host.Hostname, line))
 				}
 				return m, nil
@@ -232,36 +376,161 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				})
 				m.appendOutputs(lines...)
 				return m, nil
+			case CommandCollapse:
+				jobID := command.JobID
+				if jobID == 0 {
+					jobID = latestJobID(m.jobs)
+				}
+				if jobID == 0 {
+					m.appendOutputs("no jobs recorded")
+					return m, nil
+				}
+				job := m.jobs.Job(jobID)
+				if job == nil {
+					m.appendOutputs(fmt.Sprintf("job %d not found", jobID))
+					return m, nil
+				}
+				m.appendOutputs(collapseLines(job, m.jobOutput)...)
+				return m, nil
+			case CommandDiff:
+				job := m.jobs.Job(command.JobID)
+				if job == nil {
+					m.appendOutputs(fmt.Sprintf("job %d not found", command.JobID))
+					return m, nil
+				}
+				baseline := ""
+				if command.Target != "" {
+					host, err := m.jobHost(job, command.Target)
+					if err != nil {
+						m.appendOutputs(err.Error())
+						return m, nil
+					}
+					baseline = host
+				}
+				lines, err := diffLines(job, m.jobOutput, baseline, func(hostname, line string) string {
+					return colorizeHostLine(m.hostColors, hostname, line)
+				})
+				if err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
+				}
+				m.appendOutputs(lines...)
+				return m, nil
 			case CommandAsync:
 				if command.Arg == "" {
 					return m, nil
 				}
-				hosts := connectedHosts(m.hostList)
+				hosts := connectedHosts(m.hostList, m.selected)
+				if len(hosts) == 0 {
+					m.appendOutputs("no connected hosts")
+					return m, nil
+				}
+				if err := checkCommandTemplate(hosts, command.Arg); err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
+				}
+				job := m.jobs.CreateJob(jobs.JobTypeAsync, command.Arg, hostnames(hosts))
+				return m, runAsync(job.ID, command.Arg, hosts, m.commandTimeout(command), m.forks, m.events, m.jobs)
+			case CommandRolling:
+				hosts := connectedHosts(m.hostList, m.selected)
 				if len(hosts) == 0 {
 					m.appendOutputs("no connected hosts")
 					return m, nil
 				}
-				hostnames := hostnames(hosts)
-				job := m.jobs.CreateJob(jobs.JobTypeAsync, command.Arg, hostnames)
-				for _, host := range hosts {
-					m.jobs.MarkHostRunning(job.ID, host.Hostname)
+				if err := checkCommandTemplate(hosts, command.Arg); err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
 				}
-				return m, runAsync(job.ID, command.Arg, hosts, m.events, m.jobs)
+				job := m.jobs.CreateJob(jobs.JobTypeRolling, command.Arg, hostnames(hosts))
+				m.appendOutputs(fmt.Sprintf("job %d rolling over %d hosts, batch %d", job.ID, len(hosts), command.Rolling.Batch))
+				return m, runRollingCmd(job.ID, command.Arg, hosts, command.Rolling, m.commandTimeout(command), m.forks, m.events, m.jobs)
 			case CommandRun:
 				if command.Arg == "" {
 					return m, nil
 				}
-				hosts := connectedHosts(m.hostList)
+				hosts := connectedHosts(m.hostList, m.selected)
 				if len(hosts) == 0 {
 					m.appendOutputs("no connected hosts")
 					return m, nil
 				}
-				hostnames := hostnames(hosts)
-				job := m.jobs.CreateJob(jobs.JobTypeNormal, command.Arg, hostnames)
-				for _, host := range hosts {
-					m.jobs.MarkHostRunning(job.ID, host.Hostname)
+				if err := checkCommandTemplate(hosts, command.Arg); err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
+				}
+				return m, m.runOnHosts(hosts, command.Arg, m.commandTimeout(command))
+			case CommandOn:
+				if command.Target == "" || command.Arg == "" {
+					m.appendOutputs("usage: :on <host1,host2|/regex/> <command>")
+					return m, nil
+				}
+				hosts, err := matchHosts(connectedHosts(m.hostList, nil), command.Target)
+				if err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
 				}
-				request := sshConn.CommandRequest{JobID: job.ID, Command: wrapCommand(command.Arg, job.ID)}
+				if len(hosts) == 0 {
+					m.appendOutputs(fmt.Sprintf("no connected hosts match %s", command.Target))
+					return m, nil
+				}
+				if err := checkCommandTemplate(hosts, command.Arg); err != nil {
+					m.appendOutputs(err.Error())
+					return m, nil
+				}
+				return m, m.runOnHosts(hosts, command.Arg, m.commandTimeout(command))
+			case CommandInvalid:
+				m.appendOutputs(command.Arg)
+				return m, nil
+			case CommandFilter:
+				if command.Arg != "" {
+					filter, err := parseOutputFilter(command.Arg)
+					if err != nil {
+						m.appendOutputs(err.Error())
+						return m, nil
+					}
+					m.filter = filter
+					m.refreshPrompt()
+				}
+				if m.filter == nil {
+					m.appendOutputs("filter: off")
+				} else {
+					m.appendOutputs("filter: " + m.filter.String())
+				}
+				return m, nil
+			case CommandStream:
+				if command.Arg != "" {
+					streams, err := parseStreams(strings.Split(command.Arg, ","))
+					if err != nil {
+						m.appendOutputs(err.Error())
+						return m, nil
+					}
+					m.streams = streams
+				}
+				m.appendOutputs("showing streams: " + formatStreams(m.streams))
+				return m, nil
+			case CommandSelect, CommandDeselect:
+				m.updateSelection(command)
+				return m, nil
+			case CommandReconnect:
+				if m.hostList == nil {
+					m.appendOutputs("no hosts configured")
+					return m, nil
+				}
+				request := sshConn.CommandRequest{Kind: sshConn.CommandKindReconnect}
+				count := m.hostList.Len()
+				if command.Target != "" {
+					hosts, err := matchHosts(m.hostList.Hosts(), command.Target)
+					if err != nil {
+						m.appendOutputs(err.Error())
+						return m, nil
+					}
+					if len(hosts) == 0 {
+						m.appendOutputs(fmt.Sprintf("no hosts match %s", command.Target))
+						return m, nil
+					}
+					request.Hosts = hostnames(hosts)
+					count = len(hosts)
+				}
+				m.appendOutputs(fmt.Sprintf("reconnecting %d hosts", count))
 				return m, sendCommand(m.broker, request)
 			}
 		}
@@ -274,29 +543,46 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.SetHeight(height)
 		m.input.SetWidth(msg.Width)
 		return m, nil
+	case jobTimeoutMsg:
+		job := m.jobs.Job(msg.jobID)
+		if job == nil {
+			return m, nil
+		}
+		timedOut := make([]string, 0, len(job.HostsOrder))
+		for _, hostname := range job.HostsOrder {
+			if m.jobs.MarkHostTimedOut(job.ID, hostname) {
+				timedOut = append(timedOut, hostname)
+			}
+		}
+		if len(timedOut) == 0 {
+			return m, nil
+		}
+		m.appendOutputs(fmt.Sprintf("job %d timed out on %d hosts", job.ID, len(timedOut)))
+		request := sshConn.CommandRequest{JobID: job.ID, Kind: sshConn.CommandKindControl, ControlByte: 0x03, Hosts: timedOut}
+		return m, sendCommand(m.broker, request)
 	case outputMsg:
 		needsFlush := false
 		for _, evt := range msg.events {
+			if evt.Lost {
+				// Only a host the job was still waiting on fails; otherwise
+				// the message is not about the job at all. The message is
+				// logged before the job can finish and close its logs.
+				if !jobHostPending(m.jobs.Job(evt.JobID), evt.Hostname) {
+					evt.JobID = 0
+				}
+				needsFlush = m.recordEvent(evt) || needsFlush
+				m.jobs.MarkHostLost(evt.JobID, evt.Hostname)
+				continue
+			}
 			if prefix, jobID, exitCode, ok := jobs.ExtractSentinel(evt.Line); ok {
 				if prefix != "" {
-					if evt.System {
-						m.appendLines(prefix)
-					} else {
-						line := fmt.Sprintf("%s: %s", evt.Hostname, prefix)
-						m.appendLines(colorizeHostLine(m.hostColors, evt.Hostname, line))
-					}
-					needsFlush = true
+					evt.JobID, evt.Line = jobID, prefix
+					needsFlush = m.recordEvent(evt) || needsFlush
 				}
 				m.jobs.MarkHostDone(jobID, evt.Hostname, exitCode, exitCode == 0)
 				continue
 			}
-			if evt.System {
-				m.appendLines(evt.Line)
-			} else {
-				line := fmt.Sprintf("%s: %s", evt.Hostname, evt.Line)
-				m.appendLines(colorizeHostLine(m.hostColors, evt.Hostname, line))
-			}
-			needsFlush = true
+			needsFlush = m.recordEvent(evt) || needsFlush
 		}
 		if needsFlush {
 			m.flushOutputs()
@@ -312,7 +598,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	allowViewport := true
 	switch msg.(type) {
 	case tea.KeyMsg, tea.MouseMsg:
-		if !m.scrollMode {
+		if !m.scrollMode || m.searching {
 			allowViewport = false
 		}
 	}
@@ -322,6 +608,215 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(inputCmd, viewportCmd)
 }
 
+// updateSelection applies a `:select` or `:deselect` command to the sticky
+// active set and refreshes the prompt to show how many hosts are active.
+func (m *model) updateSelection(command Command) {
+	if command.Arg == "" {
+		if command.Kind == CommandSelect {
+			m.appendOutputs("usage: :select <all|failed|group:<name>|tag:<key=value>|host1,host2|/regex/>")
+		} else {
+			m.appendOutputs("usage: :deselect <group:<name>|tag:<key=value>|host1,host2|/regex/>")
+		}
+		return
+	}
+	if m.hostList == nil {
+		m.appendOutputs("no hosts configured")
+		return
+	}
+	all := m.hostList.Hosts()
+	hosts, err := selectHosts(all, m.jobs, command.Arg)
+	if err != nil {
+		m.appendOutputs(err.Error())
+		return
+	}
+
+	if command.Kind == CommandSelect {
+		if command.Arg == "all" {
+			m.selected = nil
+		} else {
+			m.selected = make(map[string]bool, len(hosts))
+			for _, host := range hosts {
+				m.selected[host.Hostname] = true
+			}
+		}
+	} else {
+		if m.selected == nil {
+			m.selected = make(map[string]bool, len(all))
+			for _, host := range all {
+				m.selected[host.Hostname] = true
+			}
+		}
+		for _, host := range hosts {
+			delete(m.selected, host.Hostname)
+		}
+	}
+
+	active := len(all)
+	if m.selected != nil {
+		active = len(m.selected)
+	}
+	m.refreshPrompt()
+	m.appendOutputs(fmt.Sprintf("%d of %d hosts selected", active, len(all)))
+}
+
+// refreshPrompt rebuilds the prompt from the configured one, marking an active
+// `:filter` and the `[active/total]` count of a `:select`.
+func (m *model) refreshPrompt() {
+	prompt := m.prompt
+	if m.filter != nil {
+		prompt = "[filter] " + prompt
+	}
+	if m.selected != nil && m.hostList != nil {
+		prompt = fmt.Sprintf("[%d/%d] %s", len(m.selected), m.hostList.Len(), prompt)
+	}
+	m.input.Prompt = prompt
+}
+
+// endSearchInput leaves the `/pattern` prompt and returns to scroll mode.
+func (m *model) endSearchInput() {
+	m.searching = false
+	m.input.Reset()
+	m.input.Blur()
+	m.refreshPrompt()
+}
+
+// startSearch compiles pattern and jumps to its first match at or below the
+// top of the viewport. An empty pattern repeats the last search.
+func (m *model) startSearch(pattern string) {
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			m.searchStatus = fmt.Sprintf("invalid pattern %q: %v", pattern, err)
+			return
+		}
+		m.search = re
+	}
+	m.searchLine = m.viewport.YOffset() - 1
+	m.jumpSearch(true)
+}
+
+// jumpSearch scrolls to the next match of the current search, or the previous
+// one when forward is false, wrapping around the output.
+func (m *model) jumpSearch(forward bool) {
+	if m.search == nil {
+		m.searchStatus = "no search pattern, press / to search"
+		return
+	}
+	lines := m.visibleLines()
+	from := m.searchLine - 1
+	if forward {
+		from = m.searchLine + 1
+	}
+	idx := searchLines(lines, m.search, from, forward)
+	if idx < 0 {
+		m.searchStatus = fmt.Sprintf("/%s: pattern not found", m.search)
+		return
+	}
+	m.searchLine = idx
+	m.viewport.SetYOffset(idx)
+	position, total := countMatches(lines, m.search, idx)
+	m.searchStatus = fmt.Sprintf("/%s: match %d of %d", m.search, position, total)
+}
+
+// scrollStatus is shown in place of the prompt in scroll mode.
+func (m model) scrollStatus() string {
+	parts := []string{"-- scroll --"}
+	if m.filter != nil {
+		parts = append(parts, "filter "+m.filter.String())
+	}
+	if m.searchStatus != "" {
+		parts = append(parts, m.searchStatus)
+	} else {
+		parts = append(parts, "/ to search, esc to return")
+	}
+	return strings.Join(parts, "  ")
+}
+
+// recordEvent keeps evt for `:collapse`, `:diff` and the output log, and
+// appends it to the viewport unless its stream is hidden. It reports whether a
+// line was appended.
+func (m *model) recordEvent(evt sshConn.OutputEvent) bool {
+	m.jobOutput.AppendEvent(evt)
+	m.logOutput(evt)
+	if m.streams != nil && !m.streams[evt.Stream] {
+		return false
+	}
+	text := formatEvent(m.hostColors, evt)
+	if evt.Stream == sshConn.StreamSystem {
+		m.appendLines(text)
+	} else {
+		m.output.AppendHost(evt.Hostname, evt.Line, text)
+	}
+	return true
+}
+
+// logOutput writes evt to the output log, reporting the first failure.
+func (m *model) logOutput(evt sshConn.OutputEvent) {
+	if err := m.outputLog.Write(evt); err != nil {
+		m.appendLines(err.Error())
+	}
+}
+
+// jobHost resolves target to the single host of job it names, matching
+// host:port, alias or address like `:on`.
+func (m *model) jobHost(job *jobs.Job, target string) (string, error) {
+	candidates := make([]*sshConn.Host, 0, len(job.HostsOrder))
+	if m.hostList != nil {
+		for _, host := range m.hostList.Hosts() {
+			if _, ok := job.Hosts[host.Hostname]; ok {
+				candidates = append(candidates, host)
+			}
+		}
+	}
+	hosts, err := matchHosts(candidates, target)
+	if err != nil {
+		return "", err
+	}
+	if len(hosts) != 1 {
+		return "", fmt.Errorf("%s matches %d hosts of job %d", target, len(hosts), job.ID)
+	}
+	return hosts[0].Hostname, nil
+}
+
+// commandTimeout returns the timeout for command: its `:timeout` prefix when
+// given, otherwise the configured default.
+func (m *model) commandTimeout(command Command) time.Duration {
+	if command.Timeout > 0 {
+		return command.Timeout
+	}
+	return m.timeout
+}
+
+// runOnHosts records a normal job for hosts and sends command to their
+// interactive sessions only, so delivery always matches the job's host list.
+// A command template is expanded and sent to each host separately. A positive
+// timeout interrupts the hosts still running when it expires.
+func (m *model) runOnHosts(hosts []*sshConn.Host, command string, timeout time.Duration) tea.Cmd {
+	hostnames := hostnames(hosts)
+	job := m.jobs.CreateJob(jobs.JobTypeNormal, command, hostnames)
+	for _, host := range hosts {
+		m.jobs.MarkHostRunning(job.ID, host.Hostname)
+	}
+	var cmds []tea.Cmd
+	if isCommandTemplate(command) {
+		for _, host := range hosts {
+			expanded, _ := expandCommand(host, command)
+			request := sshConn.CommandRequest{JobID: job.ID, Command: wrapCommand(expanded, job.ID), Hosts: []string{host.Hostname}}
+			cmds = append(cmds, sendCommand(m.broker, request))
+		}
+	} else {
+		request := sshConn.CommandRequest{JobID: job.ID, Command: wrapCommand(command, job.ID), Hosts: hostnames}
+		cmds = append(cmds, sendCommand(m.broker, request))
+	}
+	if timeout > 0 {
+		jobID := job.ID
+		cmds = append(cmds, tea.Tick(timeout, func(time.Time) tea.Msg {
+			return jobTimeoutMsg{jobID: jobID}
+		}))
+	}
+	return tea.Batch(cmds...)
+}
+
 func sendCommand(broker chan<- sshConn.CommandRequest, request sshConn.CommandRequest) tea.Cmd {
 	if broker == nil {
 		return nil
@@ -332,34 +827,102 @@ func sendCommand(broker chan<- sshConn.CommandRequest, request sshConn.CommandRe
 	}
 }
 
-var runCommandFunc = sshConn.RunCommand
+var runCommandFunc = sshConn.RunCommandContext
 
-func runAsync(jobID int, command string, hosts []*sshConn.Host, events chan<- sshConn.OutputEvent, manager *jobs.Manager) tea.Cmd {
+func runAsync(jobID int, command string, hosts []*sshConn.Host, timeout time.Duration, forks chan struct{}, events chan<- sshConn.OutputEvent, manager *jobs.Manager) tea.Cmd {
 	if len(hosts) == 0 {
 		return nil
 	}
 	return func() tea.Msg {
-		for _, host := range hosts {
-			h := host
-			go func() {
-				exitCode, err := runCommandFunc(h, command, jobID, events)
-				if err != nil {
-					manager.MarkHostDone(jobID, h.Hostname, exitCode, false)
-					return
-				}
-				manager.MarkHostDone(jobID, h.Hostname, exitCode, exitCode == 0)
-			}()
-		}
+		go runHosts(manager, jobID, hosts, command, timeout, forks, events)
 		return nil
 	}
 }
 
-func connectedHosts(hostList *sshConn.HostList) []*sshConn.Host {
+func runRollingCmd(jobID int, command string, hosts []*sshConn.Host, options RollingOptions, timeout time.Duration, forks chan struct{}, events chan<- sshConn.OutputEvent, manager *jobs.Manager) tea.Cmd {
+	return func() tea.Msg {
+		go runRolling(manager, jobID, hosts, command, options, timeout, forks, events)
+		return nil
+	}
+}
+
+// newForks returns the session slots shared by every async and rolling job,
+// holding at most n sessions in flight, or nil for no limit when n is zero.
+func newForks(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// runHosts runs command on every host, taking one of forks for each session
+// so that jobs running side by side share the limit, and waits for them to
+// finish. A host stays queued until it gets a slot.
+func runHosts(manager *jobs.Manager, jobID int, hosts []*sshConn.Host, command string, timeout time.Duration, forks chan struct{}, events chan<- sshConn.OutputEvent) {
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		if forks != nil {
+			forks <- struct{}{}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if forks != nil {
+				defer func() { <-forks }()
+			}
+			manager.MarkHostRunning(jobID, host.Hostname)
+			runHost(manager, jobID, host, command, timeout, events)
+		}()
+	}
+	wg.Wait()
+}
+
+// runHost runs command on host in its own session, bounded by timeout when
+// positive, and records the outcome in manager.
+func runHost(manager *jobs.Manager, jobID int, host *sshConn.Host, command string, timeout time.Duration, events chan<- sshConn.OutputEvent) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	command, err := expandCommand(host, command)
+	// Messages about the host are sent before it is marked done, since
+	// the last host finishing the job writes the job's summary.
+	if err != nil {
+		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: err.Error(), Stream: sshConn.StreamSystem, Time: time.Now()}
+		manager.MarkHostDone(jobID, host.Hostname, 1, false)
+		return
+	}
+	exitCode, err := runCommandFunc(ctx, host, command, jobID, events)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		events <- sshConn.OutputEvent{
+			JobID:    jobID,
+			Hostname: host.Hostname,
+			Line:     fmt.Sprintf("%s: timed out after %s", host.Hostname, timeout),
+			Stream:   sshConn.StreamSystem,
+			Time:     time.Now(),
+		}
+		manager.MarkHostTimedOut(jobID, host.Hostname)
+	case err != nil:
+		manager.MarkHostDone(jobID, host.Hostname, exitCode, false)
+	default:
+		manager.MarkHostDone(jobID, host.Hostname, exitCode, exitCode == 0)
+	}
+}
+
+// connectedHosts returns the connected hosts of hostList. A non-nil selected
+// set further restricts the result to the hosts it contains.
+func connectedHosts(hostList *sshConn.HostList, selected map[string]bool) []*sshConn.Host {
 	if hostList == nil {
 		return nil
 	}
 	hosts := make([]*sshConn.Host, 0, hostList.Len())
 	for _, host := range hostList.Hosts() {
+		if selected != nil && !selected[host.Hostname] {
+			continue
+		}
 		if atomic.LoadInt32(&host.IsConnected) == 1 {
 			hosts = append(hosts, host)
 		}
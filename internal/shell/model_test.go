@@ -1,10 +1,13 @@
 package shell
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -520,7 +523,7 @@ func TestOutputMsgSystemEvent(t *testing.T) {
 
 	m := initialModel(hostList, nil, nil)
 	msg := outputMsg{events: []sshConn.OutputEvent{
-		{Hostname: "host1", Line: "system msg", System: true},
+		{Hostname: "host1", Line: "system msg", Stream: sshConn.StreamSystem},
 	}}
 	updated, _ := m.Update(msg)
 	um := updated.(model)
@@ -534,6 +537,165 @@ func TestOutputMsgSystemEvent(t *testing.T) {
 	}
 }
 
+func TestOutputMsgStderrEvent(t *testing.T) {
+	prev := color.NoColor
+	color.NoColor = false
+	t.Cleanup(func() { color.NoColor = prev })
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+
+	m := initialModel(hostList, nil, nil)
+	updated, _ := m.Update(outputMsg{events: []sshConn.OutputEvent{
+		{Hostname: "host1", Line: "out"},
+		{Hostname: "host1", Line: "oops", Stream: sshConn.StreamStderr},
+	}})
+	um := updated.(model)
+
+	lines := um.output.Lines()
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %#v", lines)
+	}
+	if lines[0] != "host1: out" {
+		t.Fatalf("unexpected stdout line %q", lines[0])
+	}
+	if want := "host1: " + stderrColor.Sprint("oops"); lines[1] != want {
+		t.Fatalf("expected styled stderr line %q, got %q", want, lines[1])
+	}
+}
+
+func TestStreamCommandFiltersOutput(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+
+	m := initialModel(hostList, nil, nil)
+	m.input.SetValue(":stream stdout")
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != "showing streams: stdout" {
+		t.Fatalf("unexpected output %#v", lines)
+	}
+
+	um.output = newOutputBuffer(maxOutputLines)
+	updated, _ = um.Update(outputMsg{events: []sshConn.OutputEvent{
+		{Hostname: "host1", Line: "out"},
+		{Hostname: "host1", Line: "oops", Stream: sshConn.StreamStderr},
+		{Line: "system msg", Stream: sshConn.StreamSystem},
+	}})
+	um = updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != "host1: out" {
+		t.Fatalf("expected only stdout, got %#v", lines)
+	}
+
+	um.output = newOutputBuffer(maxOutputLines)
+	um.input.SetValue(":stream stdin")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != `unknown stream "stdin"` {
+		t.Fatalf("unexpected output %#v", lines)
+	}
+
+	um.output = newOutputBuffer(maxOutputLines)
+	um.input.SetValue(":stream all")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != "showing streams: stdout, stderr, system" {
+		t.Fatalf("unexpected output %#v", lines)
+	}
+}
+
+func TestFilterCommandRerendersOutput(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22"})
+	hostList.AddHost(&sshConn.Host{Hostname: "db1:22"})
+
+	m := initialModel(hostList, nil, nil)
+	updated, _ := m.Update(outputMsg{events: []sshConn.OutputEvent{
+		{Hostname: "web1:22", Line: "ERROR disk full"},
+		{Hostname: "web1:22", Line: "ok"},
+		{Hostname: "db1:22", Line: "ERROR replication"},
+	}})
+	um := updated.(model)
+
+	um.input.SetValue(":filter host=web* grep=ERROR")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	want := []string{"web1:22: ERROR disk full", "filter: host=web* grep=ERROR"}
+	if got := um.visibleLines(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected filtered lines %#v", got)
+	}
+	if um.input.Prompt != "[filter] "+defaultPrompt {
+		t.Fatalf("unexpected prompt %q", um.input.Prompt)
+	}
+
+	um.input.SetValue(":filter off")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if got := um.visibleLines(); len(got) != 5 {
+		t.Fatalf("expected every line after :filter off, got %#v", got)
+	}
+	if um.input.Prompt != defaultPrompt {
+		t.Fatalf("unexpected prompt %q", um.input.Prompt)
+	}
+
+	um.input.SetValue(":filter user=root")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if lines := um.output.Lines(); lines[len(lines)-1] != `invalid filter "user=root", expected host=<glob> or grep=<regex>` {
+		t.Fatalf("unexpected output %#v", lines)
+	}
+}
+
+func TestScrollSearchJumpsBetweenMatches(t *testing.T) {
+	m := initialModel(nil, nil, nil)
+	m.viewport.SetWidth(80)
+	m.viewport.SetHeight(2)
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("line %d", i)
+		if i == 5 || i == 12 {
+			line = fmt.Sprintf("ERROR %d", i)
+		}
+		m.appendLines(line)
+	}
+	m.flushOutputs()
+	m.viewport.GotoTop()
+	m.scrollMode = true
+	m.input.Blur()
+
+	press := func(m model, key rune) model {
+		updated, _ := m.Update(tea.KeyPressMsg{Code: key, Text: string(key)})
+		return updated.(model)
+	}
+	m = press(m, '/')
+	if !m.searching || m.input.Prompt != "/" {
+		t.Fatalf("expected search prompt, got searching=%t prompt=%q", m.searching, m.input.Prompt)
+	}
+	for _, r := range "ERROR" {
+		m = press(m, r)
+	}
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	if m.searching || m.viewport.YOffset() != 5 || m.searchStatus != "/ERROR: match 1 of 2" {
+		t.Fatalf("unexpected state: searching=%t offset=%d status=%q", m.searching, m.viewport.YOffset(), m.searchStatus)
+	}
+
+	m = press(m, 'n')
+	if m.viewport.YOffset() != 12 || m.searchStatus != "/ERROR: match 2 of 2" {
+		t.Fatalf("unexpected state after n: offset=%d status=%q", m.viewport.YOffset(), m.searchStatus)
+	}
+	m = press(m, 'n')
+	if m.viewport.YOffset() != 5 {
+		t.Fatalf("expected n to wrap to 5, got %d", m.viewport.YOffset())
+	}
+	m = press(m, 'N')
+	if m.viewport.YOffset() != 12 {
+		t.Fatalf("expected N to go back to 12, got %d", m.viewport.YOffset())
+	}
+	if !strings.Contains(m.View().Content, "/ERROR: match 2 of 2") {
+		t.Fatalf("expected search status in view, got %q", m.View().Content)
+	}
+}
+
 func TestCommandRunNoConnectedHosts(t *testing.T) {
 	hostList := sshConn.NewHostList()
 	hostList.AddHost(&sshConn.Host{Hostname: "host1", IsConnected: 0})
@@ -552,7 +714,7 @@ func TestCommandRunNoConnectedHosts(t *testing.T) {
 func TestRunAsyncEmptyHostsReturnsNil(t *testing.T) {
 	manager := jobs.NewManager()
 	events := make(chan sshConn.OutputEvent, 1)
-	cmd := runAsync(1, "uptime", nil, events, manager)
+	cmd := runAsync(1, "uptime", nil, 0, nil, events, manager)
 	if cmd != nil {
 		t.Fatal("expected nil cmd for empty hosts")
 	}
@@ -562,7 +724,7 @@ func TestRunAsyncStubSuccessAndFailure(t *testing.T) {
 	prev := runCommandFunc
 	t.Cleanup(func() { runCommandFunc = prev })
 
-	runCommandFunc = func(host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
 		if host.Hostname == "host1" {
 			return 0, nil
 		}
@@ -581,7 +743,7 @@ func TestRunAsyncStubSuccessAndFailure(t *testing.T) {
 	}
 
 	events := make(chan sshConn.OutputEvent, 10)
-	cmd := runAsync(job.ID, "uptime", hosts, events, manager)
+	cmd := runAsync(job.ID, "uptime", hosts, 0, nil, events, manager)
 	if cmd == nil {
 		t.Fatal("expected non-nil cmd")
 	}
@@ -620,6 +782,113 @@ func TestRunAsyncStubSuccessAndFailure(t *testing.T) {
 	}
 }
 
+func TestRunHostsBoundsConcurrency(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	manager := jobs.NewManager()
+	hosts := make([]*sshConn.Host, 0, 6)
+	for i := 1; i <= 6; i++ {
+		hosts = append(hosts, &sshConn.Host{Hostname: fmt.Sprintf("host%d", i)})
+	}
+	job := manager.CreateJob(jobs.JobTypeAsync, "uptime", hostnames(hosts))
+
+	var mu sync.Mutex
+	running, maxRunning, firstQueued := 0, 0, -1
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		if firstQueued == -1 {
+			firstQueued = 0
+			for _, status := range manager.Job(jobID).Hosts {
+				if status.State == jobs.HostQueued {
+					firstQueued++
+				}
+			}
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return 0, nil
+	}
+
+	runHosts(manager, job.ID, hosts, "uptime", 0, newForks(2), nil)
+
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 concurrent commands, got %d", maxRunning)
+	}
+	if firstQueued < len(hosts)-2 {
+		t.Fatalf("expected hosts beyond the pool to stay queued, got %d queued", firstQueued)
+	}
+	for _, status := range manager.Job(job.ID).Hosts {
+		if status.State != jobs.HostSuccess {
+			t.Fatalf("expected %s succeeded, got %v", status.Host, status.State)
+		}
+	}
+}
+
+func TestRunHostsSharesForksAcrossJobs(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	manager := jobs.NewManager()
+	hosts := make([]*sshConn.Host, 0, 4)
+	for i := 1; i <= 4; i++ {
+		hosts = append(hosts, &sshConn.Host{Hostname: fmt.Sprintf("host%d", i)})
+	}
+	first := manager.CreateJob(jobs.JobTypeAsync, "uptime", hostnames(hosts))
+	second := manager.CreateJob(jobs.JobTypeRolling, "uptime", hostnames(hosts))
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return 0, nil
+	}
+
+	forks := newForks(2)
+	var wg sync.WaitGroup
+	for _, jobID := range []int{first.ID, second.ID} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runHosts(manager, jobID, hosts, "uptime", 0, forks, nil)
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 concurrent commands across jobs, got %d", maxRunning)
+	}
+}
+
+func TestConcurrencyFromConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	if got, err := concurrencyFromConfig(); err != nil || got != 0 {
+		t.Fatalf("expected unlimited by default, got %d, %v", got, err)
+	}
+	viper.Set("async_concurrency", 25)
+	if got, err := concurrencyFromConfig(); err != nil || got != 25 {
+		t.Fatalf("expected 25, got %d, %v", got, err)
+	}
+	viper.Set("async_concurrency", "-1")
+	if _, err := concurrencyFromConfig(); err == nil {
+		t.Fatal("expected error for negative concurrency")
+	}
+}
+
 func TestCommandRunWithConnectedHosts(t *testing.T) {
 	broker := make(chan sshConn.CommandRequest, 1)
 	hostList := sshConn.NewHostList()
@@ -652,6 +921,279 @@ func TestCommandRunWithConnectedHosts(t *testing.T) {
 	}
 }
 
+func TestCommandOnTargetsSelectedHosts(t *testing.T) {
+	broker := make(chan sshConn.CommandRequest, 1)
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Alias: "web1", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22", Alias: "web2", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web3:22", Alias: "web3", IsConnected: 1})
+
+	m := initialModel(hostList, broker, nil)
+	m.input.SetValue(":on web1,web3 uptime")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+
+	normalJobs := um.jobs.NormalJobs()
+	if len(normalJobs) != 1 {
+		t.Fatalf("expected 1 normal job, got %d", len(normalJobs))
+	}
+	order := normalJobs[0].HostsOrder
+	if len(order) != 2 || order[0] != "web1:22" || order[1] != "web3:22" {
+		t.Fatalf("unexpected job hosts: %#v", order)
+	}
+
+	_ = runCmd(t, cmd)
+	req := readRequest(t, broker)
+	if len(req.Hosts) != 2 || req.Hosts[0] != "web1:22" || req.Hosts[1] != "web3:22" {
+		t.Fatalf("unexpected request hosts: %#v", req.Hosts)
+	}
+	if !strings.Contains(req.Command, "uptime") {
+		t.Fatalf("expected command to contain 'uptime', got %q", req.Command)
+	}
+}
+
+func TestCommandOnNoMatch(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Alias: "web1", IsConnected: 1})
+
+	m := initialModel(hostList, nil, nil)
+	m.input.SetValue(":on /^db/ uptime")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	if cmd != nil {
+		t.Fatal("expected nil cmd when no hosts match")
+	}
+	lines := um.output.Lines()
+	if len(lines) != 1 || lines[0] != "no connected hosts match /^db/" {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
+func TestReconnectTargetsDisconnectedHost(t *testing.T) {
+	broker := make(chan sshConn.CommandRequest, 1)
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Alias: "web1", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22", Alias: "web2", IsConnected: 0})
+
+	m := initialModel(hostList, broker, nil)
+	m.input.SetValue(":reconnect web2")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+
+	_ = runCmd(t, cmd)
+	req := readRequest(t, broker)
+	if req.Kind != sshConn.CommandKindReconnect {
+		t.Fatalf("expected reconnect kind, got %v", req.Kind)
+	}
+	if len(req.Hosts) != 1 || req.Hosts[0] != "web2:22" {
+		t.Fatalf("unexpected request hosts: %#v", req.Hosts)
+	}
+	lines := um.output.Lines()
+	if len(lines) != 1 || lines[0] != "reconnecting 1 hosts" {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
+func TestJobTimeoutInterruptsRunningHosts(t *testing.T) {
+	broker := make(chan sshConn.CommandRequest, 1)
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2", IsConnected: 1})
+
+	m := initialModel(hostList, broker, nil)
+	m.input.SetValue(":timeout 30s sleep 60")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	if cmd == nil {
+		t.Fatal("expected command")
+	}
+	job := um.jobs.NormalJobs()[0]
+	um.jobs.MarkHostDone(job.ID, "host1", 0, true)
+
+	updated, cmd = um.Update(jobTimeoutMsg{jobID: job.ID})
+	um = updated.(model)
+	_ = runCmd(t, cmd)
+	req := readRequest(t, broker)
+	if req.Kind != sshConn.CommandKindControl || req.ControlByte != 0x03 || req.JobID != job.ID {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(req.Hosts) != 1 || req.Hosts[0] != "host2" {
+		t.Fatalf("unexpected request hosts: %#v", req.Hosts)
+	}
+	if state := um.jobs.Job(job.ID).Hosts["host2"].State; state != jobs.HostTimedOut {
+		t.Fatalf("expected host2 timed out, got %v", state)
+	}
+	lines := um.output.Lines()
+	if len(lines) != 1 || lines[0] != fmt.Sprintf("job %d timed out on 1 hosts", job.ID) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+
+	// A second expiry for a finished job is a no-op.
+	if _, cmd = um.Update(jobTimeoutMsg{jobID: job.ID}); cmd != nil {
+		t.Fatal("expected nil cmd once no hosts are running")
+	}
+}
+
+func TestInitialModelRejectsInvalidTimeout(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("timeout", "soon")
+
+	m := initialModel(nil, nil, nil)
+	if m.timeout != 0 {
+		t.Fatalf("expected no timeout, got %s", m.timeout)
+	}
+	lines := m.output.Lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], `invalid timeout "soon"`) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
+func TestRunHostTimeoutMarksTimedOut(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		<-ctx.Done()
+		return 1, ctx.Err()
+	}
+
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeAsync, "sleep 60", []string{"host1"})
+	manager.MarkHostRunning(job.ID, "host1")
+	events := make(chan sshConn.OutputEvent, 1)
+	runHost(manager, job.ID, &sshConn.Host{Hostname: "host1"}, "sleep 60", 10*time.Millisecond, events)
+
+	if state := manager.Job(job.ID).Hosts["host1"].State; state != jobs.HostTimedOut {
+		t.Fatalf("expected timed out, got %v", state)
+	}
+	evt := <-events
+	if evt.Stream != sshConn.StreamSystem || evt.Line != "host1: timed out after 10ms" {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestRollingCommandCreatesQueuedJob(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	release := make(chan struct{})
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		<-release
+		return 0, nil
+	}
+
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2", IsConnected: 1})
+
+	m := initialModel(hostList, nil, make(chan sshConn.OutputEvent, 4))
+	m.input.SetValue(":rolling --batch 1 uptime")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+
+	asyncJobs := um.jobs.AsyncJobs()
+	if len(asyncJobs) != 1 || asyncJobs[0].Type != jobs.JobTypeRolling {
+		t.Fatalf("expected one rolling job, got %#v", asyncJobs)
+	}
+	job := asyncJobs[0]
+	for _, host := range job.HostsOrder {
+		if job.Hosts[host].State != jobs.HostQueued {
+			t.Fatalf("expected %s queued before the job starts, got %v", host, job.Hosts[host].State)
+		}
+	}
+	lines := um.output.Lines()
+	if len(lines) != 1 || lines[0] != fmt.Sprintf("job %d rolling over 2 hosts, batch 1", job.ID) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+
+	_ = runCmd(t, cmd)
+	close(release)
+	deadline := time.After(2 * time.Second)
+	for um.jobs.Job(job.ID).Hosts["host2"].State != jobs.HostSuccess {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for rolling job")
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestCollapseGroupsJobOutput(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22", IsConnected: 1})
+
+	m := initialModel(hostList, make(chan sshConn.CommandRequest, 1), nil)
+	m.input.SetValue("uptime")
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	jobID := um.jobs.NormalJobs()[0].ID
+
+	updated, _ = um.Update(outputMsg{events: []sshConn.OutputEvent{
+		{JobID: jobID, Hostname: "web1:22", Line: "up 1 day"},
+		{JobID: jobID, Hostname: "web2:22", Line: "up 1 day"},
+		{JobID: jobID, Hostname: "web2:22", Line: "warning", Stream: sshConn.StreamStderr},
+	}})
+	um = updated.(model)
+	um.output = newOutputBuffer(maxOutputLines)
+
+	um.input.SetValue(":collapse")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	lines := um.output.Lines()
+	want := []string{
+		fmt.Sprintf("job %d [normal] uptime: 1 distinct outputs from 2 hosts", jobID),
+		collapseSeparator, "web[1-2]:22 (2)", collapseSeparator,
+		"up 1 day",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+
+	um.output = newOutputBuffer(maxOutputLines)
+	um.input.SetValue(":collapse 99")
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != "job 99 not found" {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
+func TestDiffResolvesBaselineByAlias(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Alias: "web1", IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22", Alias: "web2", IsConnected: 1})
+
+	m := initialModel(hostList, nil, nil)
+	job := m.jobs.CreateJob(jobs.JobTypeAsync, "cat motd", []string{"web1:22", "web2:22"})
+	m.jobs.MarkHostDone(job.ID, "web1:22", 0, true)
+	m.jobs.MarkHostDone(job.ID, "web2:22", 0, true)
+	m.jobOutput.Append(job.ID, "web1:22", "hello")
+	m.jobOutput.Append(job.ID, "web2:22", "hello")
+
+	m.input.SetValue(fmt.Sprintf(":diff %d web2", job.ID))
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	lines := um.output.Lines()
+	want := []string{
+		fmt.Sprintf("job %d [async] cat motd: diff against web2:22", job.ID),
+		"1 of 1 hosts identical to web2:22",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+
+	um.output = newOutputBuffer(maxOutputLines)
+	um.input.SetValue(fmt.Sprintf(":diff %d /web/", job.ID))
+	updated, _ = um.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um = updated.(model)
+	if lines := um.output.Lines(); len(lines) != 1 || lines[0] != fmt.Sprintf("/web/ matches 2 hosts of job %d", job.ID) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
 func TestOutputMsgSystemSentinelPrefix(t *testing.T) {
 	hostList := sshConn.NewHostList()
 	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
@@ -663,7 +1205,7 @@ func TestOutputMsgSystemSentinelPrefix(t *testing.T) {
 	// System event with sentinel (covers the system sentinel prefix branch)
 	line := "error" + jobs.SentinelFor(job.ID) + ":1"
 	updated, _ := m.Update(outputMsg{events: []sshConn.OutputEvent{
-		{JobID: job.ID, Hostname: "host1", Line: line, System: true},
+		{JobID: job.ID, Hostname: "host1", Line: line, Stream: sshConn.StreamSystem},
 	}})
 	um := updated.(model)
 
@@ -676,6 +1218,34 @@ func TestOutputMsgSystemSentinelPrefix(t *testing.T) {
 	}
 }
 
+func TestOutputMsgLostSessionFailsRunningHost(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "host1"})
+	hostList.AddHost(&sshConn.Host{Hostname: "host2"})
+
+	m := initialModel(hostList, nil, nil)
+	job := m.jobs.CreateJob(jobs.JobTypeNormal, "sleep 60", []string{"host1", "host2"})
+	m.jobs.MarkHostRunning(job.ID, "host1")
+	m.jobs.MarkHostDone(job.ID, "host2", 0, true)
+
+	updated, _ := m.Update(outputMsg{events: []sshConn.OutputEvent{
+		{JobID: job.ID, Hostname: "host1", Line: "connection to host1 lost: EOF, reconnecting", Stream: sshConn.StreamSystem, Lost: true},
+		{JobID: job.ID, Hostname: "host2", Line: "reconnecting to host2", Stream: sshConn.StreamSystem, Lost: true},
+	}})
+	um := updated.(model)
+
+	got := um.jobs.Job(job.ID)
+	if status := got.Hosts["host1"]; status.State != jobs.HostFailed || status.ExitCode != 1 {
+		t.Fatalf("expected lost host to fail, got %+v", status)
+	}
+	if status := got.Hosts["host2"]; status.State != jobs.HostSuccess {
+		t.Fatalf("expected finished host to keep its result, got %+v", status)
+	}
+	if lines := um.output.Lines(); len(lines) != 2 {
+		t.Fatalf("expected both messages shown, got %#v", lines)
+	}
+}
+
 func TestWindowSizeMsgZeroHeight(t *testing.T) {
 	m := initialModel(nil, nil, nil)
 	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 0})
@@ -744,7 +1314,7 @@ func TestConnectedHosts(t *testing.T) {
 	hostList.AddHost(&sshConn.Host{Hostname: "host1", IsConnected: 1})
 	hostList.AddHost(&sshConn.Host{Hostname: "host2", IsConnected: 0})
 
-	hosts := connectedHosts(hostList)
+	hosts := connectedHosts(hostList, nil)
 	if len(hosts) != 1 {
 		t.Fatalf("expected 1 connected host, got %d", len(hosts))
 	}
@@ -754,7 +1324,7 @@ func TestConnectedHosts(t *testing.T) {
 }
 
 func TestConnectedHostsNilList(t *testing.T) {
-	if got := connectedHosts(nil); got != nil {
+	if got := connectedHosts(nil, nil); got != nil {
 		t.Fatalf("expected nil hosts, got %#v", got)
 	}
 }
@@ -836,3 +1406,101 @@ func TestInitReturnsOutputBatchFromEvents(t *testing.T) {
 		t.Fatalf("expected 2 events, got %d", len(got.events))
 	}
 }
+
+func TestRunCommandTemplateSendsPerHostRequests(t *testing.T) {
+	broker := make(chan sshConn.CommandRequest, 2)
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Tags: map[string]string{"role": "web"}, IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "db1:22", Tags: map[string]string{"role": "db"}, IsConnected: 1})
+
+	m := initialModel(hostList, broker, nil)
+	m.input.SetValue("systemctl restart {{.Tags.role}}")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+
+	normalJobs := um.jobs.NormalJobs()
+	if len(normalJobs) != 1 || normalJobs[0].Command != "systemctl restart {{.Tags.role}}" {
+		t.Fatalf("unexpected jobs: %#v", normalJobs)
+	}
+	batch, ok := runCmd(t, cmd).(tea.BatchMsg)
+	if !ok || len(batch) != 2 {
+		t.Fatalf("expected a batch of two sends, got %#v", batch)
+	}
+	for _, send := range batch {
+		send()
+	}
+	for _, want := range []struct{ host, command string }{{"web1:22", "systemctl restart web"}, {"db1:22", "systemctl restart db"}} {
+		req := readRequest(t, broker)
+		if len(req.Hosts) != 1 || req.Hosts[0] != want.host || !strings.HasPrefix(req.Command, want.command+"; ") {
+			t.Fatalf("unexpected request: %#v", req)
+		}
+	}
+}
+
+func TestRunCommandTemplateMissingTag(t *testing.T) {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Tags: map[string]string{"role": "web"}, IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "db1:22", IsConnected: 1})
+
+	m := initialModel(hostList, nil, nil)
+	m.input.SetValue(":async restart {{.Tags.role}}")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	um := updated.(model)
+	if cmd != nil {
+		t.Fatal("expected no command when the template fails")
+	}
+	if len(um.jobs.AsyncJobs()) != 0 {
+		t.Fatal("expected no job when the template fails")
+	}
+	lines := um.output.Lines()
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "db1:22: ") {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+}
+
+func TestRunHostsExpandsCommandTemplate(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+	var mu sync.Mutex
+	commands := map[string]string{}
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		commands[host.Hostname] = command
+		return 0, nil
+	}
+
+	manager := jobs.NewManager()
+	hosts := []*sshConn.Host{
+		{Hostname: "web1:22", Tags: map[string]string{"az": "a"}},
+		{Hostname: "web2:22", Tags: map[string]string{"az": "b"}},
+	}
+	job := manager.CreateJob(jobs.JobTypeAsync, "echo {{.Tags.az}}", hostnames(hosts))
+	runHosts(manager, job.ID, hosts, "echo {{.Tags.az}}", 0, nil, make(chan sshConn.OutputEvent, 10))
+
+	if commands["web1:22"] != "echo a" || commands["web2:22"] != "echo b" {
+		t.Fatalf("unexpected commands: %#v", commands)
+	}
+}
+
+func TestRunHostReportsTimeoutBeforeJobFinishes(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		return 1, context.DeadlineExceeded
+	}
+
+	manager := jobs.NewManager()
+	events := make(chan sshConn.OutputEvent, 4)
+	queued := -1
+	manager.OnJobFinished(func(job *jobs.Job) { queued = len(events) })
+	job := manager.CreateJob(jobs.JobTypeAsync, "sleep 60", []string{"host1"})
+	runHost(manager, job.ID, &sshConn.Host{Hostname: "host1"}, "sleep 60", time.Second, events)
+
+	if queued != 1 {
+		t.Fatalf("expected the timeout message queued before the job finished, got %d", queued)
+	}
+	if evt := <-events; evt.Line != "host1: timed out after 1s" {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
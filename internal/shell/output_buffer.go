@@ -2,8 +2,16 @@ package shell
 
 import "strings"
 
+// outputLine is one rendered line of the viewport. Host output also keeps the
+// host and the raw line so `:filter` can match on them.
+type outputLine struct {
+	host string
+	line string
+	text string
+}
+
 type outputBuffer struct {
-	lines []string
+	lines []outputLine
 	start int
 	size  int
 	max   int
@@ -13,33 +21,51 @@ func newOutputBuffer(max int) *outputBuffer {
 	if max < 0 {
 		max = 0
 	}
-	return &outputBuffer{lines: make([]string, max), max: max}
+	return &outputBuffer{lines: make([]outputLine, max), max: max}
 }
 
+// Append adds lines that do not belong to a host, such as command feedback.
 func (b *outputBuffer) Append(lines ...string) {
 	for _, line := range lines {
-		if b.max == 0 {
-			continue
-		}
-		if b.size < b.max {
-			idx := (b.start + b.size) % b.max
-			b.lines[idx] = line
-			b.size++
-			continue
-		}
-		b.lines[b.start] = line
-		b.start = (b.start + 1) % b.max
+		b.append(outputLine{line: line, text: line})
+	}
+}
+
+// AppendHost adds line as output of host, rendered as text.
+func (b *outputBuffer) AppendHost(host, line, text string) {
+	b.append(outputLine{host: host, line: line, text: text})
+}
+
+func (b *outputBuffer) append(line outputLine) {
+	if b.max == 0 {
+		return
 	}
+	if b.size < b.max {
+		idx := (b.start + b.size) % b.max
+		b.lines[idx] = line
+		b.size++
+		return
+	}
+	b.lines[b.start] = line
+	b.start = (b.start + 1) % b.max
 }
 
 func (b *outputBuffer) Lines() []string {
+	return b.Filter(nil)
+}
+
+// Filter returns the rendered lines for which keep returns true, or every line
+// when keep is nil.
+func (b *outputBuffer) Filter(keep func(outputLine) bool) []string {
 	if b.size == 0 {
 		return nil
 	}
 	out := make([]string, 0, b.size)
 	for i := 0; i < b.size; i++ {
-		idx := (b.start + i) % b.max
-		out = append(out, b.lines[idx])
+		line := b.lines[(b.start+i)%b.max]
+		if keep == nil || keep(line) {
+			out = append(out, line.text)
+		}
 	}
 	return out
 }
@@ -55,7 +81,7 @@ func (b *outputBuffer) String() string {
 		if i > 0 {
 			sb.WriteByte('\n')
 		}
-		sb.WriteString(b.lines[idx])
+		sb.WriteString(b.lines[idx].text)
 	}
 	return sb.String()
 }
@@ -0,0 +1,216 @@
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/viper"
+)
+
+// outputLog writes job output to <dir>/<job-id>/<host>.out and .err, and a
+// summary.json per job once it finishes. After the first failure the log
+// stops writing so the error is only reported once.
+type outputLog struct {
+	dir    string
+	mu     sync.Mutex
+	files  map[string]*os.File
+	failed bool
+
+	// summarized holds the jobs whose summary is written. Their output files
+	// are closed, and lines still arriving are appended without keeping the
+	// files open.
+	summarized map[int]bool
+}
+
+// hostResult is the per-host outcome written to summary.json.
+type hostResult struct {
+	Host     string  `json:"host"`
+	State    string  `json:"state"`
+	ExitCode int     `json:"exit_code"`
+	Duration float64 `json:"duration"`
+}
+
+type jobSummary struct {
+	JobID   int          `json:"job_id"`
+	Type    string       `json:"type"`
+	Command string       `json:"command"`
+	Created time.Time    `json:"created"`
+	Hosts   []hostResult `json:"hosts"`
+}
+
+func newOutputLog(dir string) *outputLog {
+	return &outputLog{dir: dir, files: map[string]*os.File{}, summarized: map[int]bool{}}
+}
+
+// outputLogFromConfig returns the log configured by `output_dir` or
+// --output-dir, or nil when output logging is off. Job IDs restart with every
+// run, so each run writes below a directory of its own.
+func outputLogFromConfig() *outputLog {
+	dir := strings.TrimSpace(viper.GetString("output_dir"))
+	if dir == "" {
+		return nil
+	}
+	return newOutputLog(filepath.Join(dir, runDirName(time.Now(), os.Getpid())))
+}
+
+// runDirName names the output directory of the run started at start by
+// process pid, such as 20261018-153045-4242, so runs sort by start time.
+func runDirName(start time.Time, pid int) string {
+	return fmt.Sprintf("%s-%d", start.Format("20060102-150405"), pid)
+}
+
+// Dir returns the directory the log writes to.
+func (l *outputLog) Dir() string {
+	if l == nil {
+		return ""
+	}
+	return l.dir
+}
+
+// Write appends the line of evt to the job's file for its host. Stdout goes to
+// .out; stderr and system messages about the host, such as a timeout, go to
+// .err. Events without a job or host are not logged.
+func (l *outputLog) Write(evt sshConn.OutputEvent) error {
+	if l == nil || evt.JobID <= 0 || evt.Hostname == "" {
+		return nil
+	}
+	ext := ".out"
+	if evt.Stream != sshConn.StreamStdout {
+		ext = ".err"
+	}
+	path := filepath.Join(l.jobDir(evt.JobID), hostFileName(evt.Hostname)+ext)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return nil
+	}
+	if l.summarized[evt.JobID] {
+		return l.failLocked(appendToFile(path, evt.Line))
+	}
+	file, err := l.fileLocked(path)
+	if err == nil {
+		_, err = fmt.Fprintln(file, evt.Line)
+	}
+	return l.failLocked(err)
+}
+
+// appendToFile appends line to the file at path and closes it again.
+func appendToFile(path, line string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(file, line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteSummary writes summary.json for job and closes its output files.
+func (l *outputLog) WriteSummary(job *jobs.Job) error {
+	if l == nil || job == nil {
+		return nil
+	}
+	summary := jobSummary{
+		JobID:   job.ID,
+		Type:    string(job.Type),
+		Command: job.Command,
+		Created: job.Created,
+		Hosts:   hostResults(job),
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dir := l.jobDir(job.ID)
+	l.summarized[job.ID] = true
+	for path, file := range l.files {
+		if filepath.Dir(path) == dir {
+			file.Close()
+			delete(l.files, path)
+		}
+	}
+	if l.failed {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return l.failLocked(err)
+	}
+	return l.failLocked(os.WriteFile(filepath.Join(dir, "summary.json"), append(data, '\n'), 0o644))
+}
+
+// Close closes every open output file.
+func (l *outputLog) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for path, file := range l.files {
+		file.Close()
+		delete(l.files, path)
+	}
+}
+
+func (l *outputLog) jobDir(jobID int) string {
+	return filepath.Join(l.dir, strconv.Itoa(jobID))
+}
+
+func (l *outputLog) fileLocked(path string) (*os.File, error) {
+	if file := l.files[path]; file != nil {
+		return file, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.files[path] = file
+	return file, nil
+}
+
+func (l *outputLog) failLocked(err error) error {
+	if err == nil {
+		return nil
+	}
+	l.failed = true
+	return fmt.Errorf("output log disabled: %w", err)
+}
+
+// hostResults lists the outcome of every host of job in job order.
+func hostResults(job *jobs.Job) []hostResult {
+	results := make([]hostResult, 0, len(job.HostsOrder))
+	for _, host := range job.HostsOrder {
+		status := job.Hosts[host]
+		if status == nil {
+			continue
+		}
+		results = append(results, hostResult{
+			Host:     status.Host,
+			State:    string(status.State),
+			ExitCode: status.ExitCode,
+			Duration: status.Elapsed().Seconds(),
+		})
+	}
+	return results
+}
+
+// hostFileName turns a host name such as web1:22 into a portable file name.
+func hostFileName(hostname string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(hostname)
+}
@@ -0,0 +1,147 @@
+package shell
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+	"github.com/spf13/viper"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestOutputLogWritesStreamsPerHost(t *testing.T) {
+	dir := t.TempDir()
+	log := newOutputLog(dir)
+	defer log.Close()
+	for _, evt := range []sshConn.OutputEvent{
+		{JobID: 1, Hostname: "web1:22", Line: "hello"},
+		{JobID: 1, Hostname: "web1:22", Line: "oops", Stream: sshConn.StreamStderr},
+		{JobID: 1, Hostname: "web1:22", Line: "world"},
+		{JobID: 0, Hostname: "web1:22", Line: "no job"},
+		{JobID: 1, Line: "no host", Stream: sshConn.StreamSystem},
+	} {
+		if err := log.Write(evt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := readFile(t, filepath.Join(dir, "1", "web1_22.out")); got != "hello\nworld\n" {
+		t.Fatalf("unexpected .out: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "1", "web1_22.err")); got != "oops\n" {
+		t.Fatalf("unexpected .err: %q", got)
+	}
+}
+
+func TestOutputLogWritesSummary(t *testing.T) {
+	dir := t.TempDir()
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeAsync, "uptime", []string{"host1", "host2"})
+	manager.MarkHostDone(job.ID, "host1", 0, true)
+	manager.MarkHostDone(job.ID, "host2", 3, false)
+
+	log := newOutputLog(dir)
+	if err := log.WriteSummary(manager.Job(job.ID)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var summary jobSummary
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(dir, "1", "summary.json"))), &summary); err != nil {
+		t.Fatalf("invalid summary: %v", err)
+	}
+	if summary.JobID != 1 || summary.Type != "async" || summary.Command != "uptime" || len(summary.Hosts) != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if host := summary.Hosts[1]; host.Host != "host2" || host.State != "failed" || host.ExitCode != 3 {
+		t.Fatalf("unexpected host result: %+v", host)
+	}
+}
+
+func TestOutputLogWriteAfterSummaryKeepsNoFileOpen(t *testing.T) {
+	dir := t.TempDir()
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeAsync, "uptime", []string{"host1"})
+
+	log := newOutputLog(dir)
+	if err := log.Write(sshConn.OutputEvent{JobID: job.ID, Hostname: "host1", Line: "first"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manager.MarkHostDone(job.ID, "host1", 0, true)
+	if err := log.WriteSummary(manager.Job(job.ID)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The host's last line may still be queued when the job finishes.
+	if err := log.Write(sshConn.OutputEvent{JobID: job.ID, Hostname: "host1", Line: "last"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(log.files) != 0 {
+		t.Fatalf("expected no open files after the summary, got %d", len(log.files))
+	}
+	if got := readFile(t, filepath.Join(dir, "1", "host1.out")); got != "first\nlast\n" {
+		t.Fatalf("unexpected .out: %q", got)
+	}
+}
+
+func TestOutputLogStopsAfterFirstFailure(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := newOutputLog(blocker)
+	if err := log.Write(sshConn.OutputEvent{JobID: 1, Hostname: "host1", Line: "x"}); err == nil {
+		t.Fatal("expected error when the output dir is a file")
+	}
+	if err := log.Write(sshConn.OutputEvent{JobID: 1, Hostname: "host1", Line: "y"}); err != nil {
+		t.Fatalf("expected later writes to be dropped silently, got %v", err)
+	}
+}
+
+func TestOutputLogFromConfigKeepsEarlierRuns(t *testing.T) {
+	dir := t.TempDir()
+	previous := filepath.Join(dir, "20260101-120000-99", "1", "web1_22.out")
+	if err := os.MkdirAll(filepath.Dir(previous), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previous, []byte("previous run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("output_dir", dir)
+
+	log := outputLogFromConfig()
+	defer log.Close()
+	if filepath.Dir(log.Dir()) != dir || log.Dir() == filepath.Dir(filepath.Dir(previous)) {
+		t.Fatalf("expected a new run directory under %s, got %s", dir, log.Dir())
+	}
+	if err := log.Write(sshConn.OutputEvent{JobID: 1, Hostname: "web1:22", Line: "this run"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readFile(t, previous); got != "previous run\n" {
+		t.Fatalf("earlier run was overwritten: %q", got)
+	}
+	if got := readFile(t, filepath.Join(log.Dir(), "1", "web1_22.out")); got != "this run\n" {
+		t.Fatalf("unexpected .out: %q", got)
+	}
+}
+
+func TestRunDirName(t *testing.T) {
+	start := time.Date(2026, 10, 18, 15, 30, 45, 0, time.UTC)
+	if got := runDirName(start, 4242); got != "20261018-153045-4242" {
+		t.Fatalf("unexpected run dir name: %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+package shell
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// RollingOptions controls how a job is spread over its hosts. Batch hosts run
+// at a time, zero meaning all of them at once. Once MaxFail hosts have failed
+// the remaining hosts are skipped; zero never aborts.
+type RollingOptions struct {
+	Batch   int
+	MaxFail int
+}
+
+// runRolling runs command on hosts in waves of options.Batch, waiting for each
+// wave to finish before starting the next. Sessions take slots from forks,
+// shared with every other job. Hosts stay queued until they start. It reports whether
+// the job was aborted.
+func runRolling(manager *jobs.Manager, jobID int, hosts []*sshConn.Host, command string, options RollingOptions, timeout time.Duration, forks chan struct{}, events chan<- sshConn.OutputEvent) bool {
+	batch := options.Batch
+	if batch <= 0 || batch > len(hosts) {
+		batch = len(hosts)
+	}
+	for start := 0; start < len(hosts); start += batch {
+		if failed := failedHosts(manager.Job(jobID)); options.MaxFail > 0 && failed >= options.MaxFail {
+			skipped := 0
+			for _, host := range hosts[start:] {
+				if manager.MarkHostSkipped(jobID, host.Hostname) {
+					skipped++
+				}
+			}
+			events <- sshConn.OutputEvent{
+				JobID:  jobID,
+				Line:   fmt.Sprintf("job %d aborted after %d failed hosts, skipped %d hosts", jobID, failed, skipped),
+				Stream: sshConn.StreamSystem,
+				Time:   time.Now(),
+			}
+			return true
+		}
+
+		end := min(start+batch, len(hosts))
+		runHosts(manager, jobID, hosts[start:end], command, timeout, forks, events)
+	}
+	return false
+}
+
+// failedHosts counts the hosts of job that finished without succeeding.
+func failedHosts(job *jobs.Job) int {
+	if job == nil {
+		return 0
+	}
+	failed := 0
+	for _, status := range job.Hosts {
+		if status.State == jobs.HostFailed || status.State == jobs.HostTimedOut {
+			failed++
+		}
+	}
+	return failed
+}
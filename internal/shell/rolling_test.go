@@ -0,0 +1,129 @@
+package shell
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func rollingHosts(names ...string) []*sshConn.Host {
+	hosts := make([]*sshConn.Host, 0, len(names))
+	for _, name := range names {
+		hosts = append(hosts, &sshConn.Host{Hostname: name})
+	}
+	return hosts
+}
+
+func TestRunRollingRunsInWaves(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	manager := jobs.NewManager()
+	hosts := rollingHosts("host1", "host2", "host3", "host4", "host5")
+	job := manager.CreateJob(jobs.JobTypeRolling, "deploy", hostnames(hosts))
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var queuedAtStart []int
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		if host.Hostname == "host1" {
+			queued := 0
+			for _, name := range []string{"host3", "host4", "host5"} {
+				if manager.Job(jobID).Hosts[name].State == jobs.HostQueued {
+					queued++
+				}
+			}
+			queuedAtStart = append(queuedAtStart, queued)
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		return 0, nil
+	}
+
+	events := make(chan sshConn.OutputEvent, 8)
+	if runRolling(manager, job.ID, hosts, "deploy", RollingOptions{Batch: 2, MaxFail: 1}, 0, nil, events) {
+		t.Fatal("expected rolling job to complete")
+	}
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 hosts at a time, got %d", maxRunning)
+	}
+	if len(queuedAtStart) != 1 || queuedAtStart[0] != 3 {
+		t.Fatalf("expected later waves to stay queued, got %v", queuedAtStart)
+	}
+	for _, status := range manager.Job(job.ID).Hosts {
+		if status.State != jobs.HostSuccess {
+			t.Fatalf("expected %s succeeded, got %v", status.Host, status.State)
+		}
+	}
+}
+
+func TestRunRollingAbortsAtMaxFail(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		if host.Hostname == "host1" || host.Hostname == "host3" {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	manager := jobs.NewManager()
+	hosts := rollingHosts("host1", "host2", "host3", "host4", "host5")
+	job := manager.CreateJob(jobs.JobTypeRolling, "deploy", hostnames(hosts))
+
+	events := make(chan sshConn.OutputEvent, 8)
+	if !runRolling(manager, job.ID, hosts, "deploy", RollingOptions{Batch: 2, MaxFail: 2}, 0, nil, events) {
+		t.Fatal("expected rolling job to abort")
+	}
+
+	want := map[string]jobs.HostState{
+		"host1": jobs.HostFailed,
+		"host2": jobs.HostSuccess,
+		"host3": jobs.HostFailed,
+		"host4": jobs.HostSuccess,
+		"host5": jobs.HostSkipped,
+	}
+	snap := manager.Job(job.ID)
+	for host, state := range want {
+		if snap.Hosts[host].State != state {
+			t.Fatalf("expected %s %v, got %v", host, state, snap.Hosts[host].State)
+		}
+	}
+	evt := <-events
+	if evt.Stream != sshConn.StreamSystem || evt.Line != "job 1 aborted after 2 failed hosts, skipped 1 hosts" {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestRunRollingWithoutThresholdRunsEveryHost(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		return 1, nil
+	}
+
+	manager := jobs.NewManager()
+	hosts := rollingHosts("host1", "host2", "host3")
+	job := manager.CreateJob(jobs.JobTypeAsync, "false", hostnames(hosts))
+
+	if runRolling(manager, job.ID, hosts, "false", RollingOptions{}, 0, nil, nil) {
+		t.Fatal("expected job without threshold to run to completion")
+	}
+	for _, status := range manager.Job(job.ID).Hosts {
+		if status.State != jobs.HostFailed {
+			t.Fatalf("expected %s failed, got %v", status.Host, status.State)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"strings"
+
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+const (
+	groupSelectorPrefix = "group:"
+	tagSelectorPrefix   = "tag:"
+)
+
+// selectHosts resolves a `:select`/`:deselect` argument against hosts. Besides
+// the host lists and /regex/ accepted by `:on`, it understands `all`, `failed`
+// (hosts whose last finished job did not succeed), `group:<name>` and
+// `tag:<key>=<value>` or `tag:<key>`.
+func selectHosts(hosts []*sshConn.Host, manager *jobs.Manager, selector string) ([]*sshConn.Host, error) {
+	selector = strings.TrimSpace(selector)
+	switch {
+	case selector == "all":
+		return hosts, nil
+	case selector == "failed":
+		failed := make(map[string]bool)
+		if manager != nil {
+			for _, hostname := range manager.FailedHosts() {
+				failed[hostname] = true
+			}
+		}
+		selected := make([]*sshConn.Host, 0, len(failed))
+		for _, host := range hosts {
+			if failed[host.Hostname] {
+				selected = append(selected, host)
+			}
+		}
+		return selected, nil
+	case strings.HasPrefix(selector, groupSelectorPrefix):
+		group := strings.TrimPrefix(selector, groupSelectorPrefix)
+		selected := make([]*sshConn.Host, 0, len(hosts))
+		for _, host := range hosts {
+			for _, name := range host.Groups {
+				if name == group {
+					selected = append(selected, host)
+					break
+				}
+			}
+		}
+		return selected, nil
+	case strings.HasPrefix(selector, tagSelectorPrefix):
+		tag := strings.TrimPrefix(selector, tagSelectorPrefix)
+		selected := make([]*sshConn.Host, 0, len(hosts))
+		for _, host := range hosts {
+			if host.HasTag(tag) {
+				selected = append(selected, host)
+			}
+		}
+		return selected, nil
+	default:
+		return matchHosts(hosts, selector)
+	}
+}
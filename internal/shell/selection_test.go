@@ -0,0 +1,151 @@
+package shell
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/ncode/pretty/internal/jobs"
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func selectionHostList() *sshConn.HostList {
+	hostList := sshConn.NewHostList()
+	hostList.AddHost(&sshConn.Host{Hostname: "web1:22", Alias: "web1", Groups: []string{"web"}, IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "web2:22", Alias: "web2", Groups: []string{"web"}, IsConnected: 1})
+	hostList.AddHost(&sshConn.Host{Hostname: "db1:22", Alias: "db1", Groups: []string{"db"}, IsConnected: 1})
+	return hostList
+}
+
+func TestSelectHostsGroup(t *testing.T) {
+	got, err := selectHosts(selectionHostList().Hosts(), nil, "group:web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Alias != "web1" || got[1].Alias != "web2" {
+		t.Fatalf("unexpected hosts: %#v", hostnames(got))
+	}
+}
+
+func TestSelectHostsFailed(t *testing.T) {
+	manager := jobs.NewManager()
+	job := manager.CreateJob(jobs.JobTypeNormal, "false", []string{"web1:22", "db1:22"})
+	manager.MarkHostDone(job.ID, "web1:22", 0, true)
+	manager.MarkHostDone(job.ID, "db1:22", 1, false)
+
+	got, err := selectHosts(selectionHostList().Hosts(), manager, "failed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Alias != "db1" {
+		t.Fatalf("unexpected hosts: %#v", hostnames(got))
+	}
+}
+
+func TestSelectRestrictsRunAndPrompt(t *testing.T) {
+	broker := make(chan sshConn.CommandRequest, 1)
+	m := initialModel(selectionHostList(), broker, nil)
+	m.prompt = "> "
+
+	m.input.SetValue(":select group:web")
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	if m.input.Prompt != "[2/3] > " {
+		t.Fatalf("unexpected prompt: %q", m.input.Prompt)
+	}
+
+	m.input.SetValue(":deselect web2")
+	updated, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	if m.input.Prompt != "[1/3] > " {
+		t.Fatalf("unexpected prompt: %q", m.input.Prompt)
+	}
+
+	m.input.SetValue("uptime")
+	updated, cmd := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	_ = runCmd(t, cmd)
+	req := readRequest(t, broker)
+	if len(req.Hosts) != 1 || req.Hosts[0] != "web1:22" {
+		t.Fatalf("unexpected request hosts: %#v", req.Hosts)
+	}
+
+	m.input.SetValue(":select all")
+	updated, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	if m.selected != nil || m.input.Prompt != "> " {
+		t.Fatalf("expected selection cleared, got %v prompt %q", m.selected, m.input.Prompt)
+	}
+}
+
+func TestSelectAppliesToAsync(t *testing.T) {
+	prev := runCommandFunc
+	t.Cleanup(func() { runCommandFunc = prev })
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+		return 0, nil
+	}
+
+	m := initialModel(selectionHostList(), nil, nil)
+	m.input.SetValue(":select db1")
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+
+	m.input.SetValue(":async uptime")
+	updated, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	asyncJobs := m.jobs.AsyncJobs()
+	if len(asyncJobs) != 1 || len(asyncJobs[0].HostsOrder) != 1 || asyncJobs[0].HostsOrder[0] != "db1:22" {
+		t.Fatalf("unexpected async job hosts: %#v", asyncJobs)
+	}
+}
+
+func TestListMarksSelectedHosts(t *testing.T) {
+	m := initialModel(selectionHostList(), nil, nil)
+	m.input.SetValue(":select db1")
+	updated, _ := m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+
+	m.input.SetValue(":list")
+	updated, _ = m.Update(tea.KeyPressMsg{Code: tea.KeyEnter})
+	m = updated.(model)
+	lines := m.output.Lines()
+	want := []string{
+		"1 of 3 hosts selected",
+		"web1:22: Connected(true) Selected(false)",
+		"web2:22: Connected(true) Selected(false)",
+		"db1:22: Connected(true) Selected(true)",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected output: %#v", lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("unexpected line %d: %q", i, lines[i])
+		}
+	}
+}
+
+func TestSelectHostsTag(t *testing.T) {
+	hosts := []*sshConn.Host{
+		{Hostname: "web1:22", Tags: map[string]string{"role": "web", "az": "a"}},
+		{Hostname: "web2:22", Tags: map[string]string{"role": "web", "az": "b"}},
+		{Hostname: "db1:22", Tags: map[string]string{"role": "db"}},
+		{Hostname: "cache1:22"},
+	}
+	tests := map[string][]string{
+		"tag:role=web": {"web1:22", "web2:22"},
+		"tag:az":       {"web1:22", "web2:22"},
+		"tag:az=b":     {"web2:22"},
+		"tag:role=api": {},
+	}
+	for selector, want := range tests {
+		got, err := selectHosts(hosts, nil, selector)
+		if err != nil {
+			t.Fatalf("selectHosts(%q): unexpected error: %v", selector, err)
+		}
+		if names := hostnames(got); len(names) != len(want) || (len(want) > 0 && !reflect.DeepEqual(names, want)) {
+			t.Fatalf("selectHosts(%q) = %v, want %v", selector, names, want)
+		}
+	}
+}
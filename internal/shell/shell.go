@@ -31,7 +31,9 @@ func Spawn(hostList *sshConn.HostList) {
 	events := make(chan sshConn.OutputEvent, outputBufferSize(hostCount))
 	go sshConn.Broker(hostList, broker, events)
 
-	if _, err := runProgram(initialModel(hostList, broker, events)); err != nil {
+	m := initialModel(hostList, broker, events)
+	defer m.outputLog.Close()
+	if _, err := runProgram(m); err != nil {
 		panic(err)
 	}
 }
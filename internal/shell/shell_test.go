@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -26,7 +27,7 @@ func TestAsyncCommandViaTeatest(t *testing.T) {
 	prev := runCommandFunc
 	t.Cleanup(func() { runCommandFunc = prev })
 
-	runCommandFunc = func(host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
+	runCommandFunc = func(ctx context.Context, host *sshConn.Host, command string, jobID int, events chan<- sshConn.OutputEvent) (int, error) {
 		events <- sshConn.OutputEvent{JobID: jobID, Hostname: host.Hostname, Line: "output-from-" + host.Hostname}
 		return 0, nil
 	}
@@ -69,3 +69,24 @@ func formatHostStatus(status *jobs.HostStatus, colorize hostLineColorizer) strin
 	}
 	return colorize(status.Host, line)
 }
+
+// latestJobID returns the ID of the most recent job, or zero when there is none.
+func latestJobID(manager *jobs.Manager) int {
+	latest := 0
+	for _, job := range manager.NormalJobs() {
+		latest = max(latest, job.ID)
+	}
+	for _, job := range manager.AsyncJobs() {
+		latest = max(latest, job.ID)
+	}
+	return latest
+}
+
+// jobHostPending reports whether job is still waiting on host.
+func jobHostPending(job *jobs.Job, host string) bool {
+	if job == nil {
+		return false
+	}
+	status := job.Hosts[host]
+	return status != nil && (status.State == jobs.HostQueued || status.State == jobs.HostRunning)
+}
@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"strings"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+var allStreams = []sshConn.Stream{sshConn.StreamStdout, sshConn.StreamStderr, sshConn.StreamSystem}
+
+// parseStreams parses stream names such as "stdout" or "stderr". "all", or no
+// names at all, returns nil, which shows every stream.
+func parseStreams(names []string) (map[sshConn.Stream]bool, error) {
+	streams := make(map[sshConn.Stream]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "all":
+			return nil, nil
+		}
+		stream, err := sshConn.ParseStream(name)
+		if err != nil {
+			return nil, err
+		}
+		streams[stream] = true
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams, nil
+}
+
+// formatStreams lists the streams shown by streams.
+func formatStreams(streams map[sshConn.Stream]bool) string {
+	names := make([]string, 0, len(allStreams))
+	for _, stream := range allStreams {
+		if streams == nil || streams[stream] {
+			names = append(names, stream.String())
+		}
+	}
+	return strings.Join(names, ", ")
+}
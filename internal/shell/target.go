@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// matchHosts returns the hosts selected by target, preserving their order in
+// hosts. A target wrapped in slashes is a regular expression matched against
+// the host name and alias; anything else is a comma separated list where each
+// entry must equal the host name (host:port), alias or address of a host.
+func matchHosts(hosts []*sshConn.Host, target string) ([]*sshConn.Host, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("host target is empty")
+	}
+
+	var match func(host *sshConn.Host) bool
+	if len(target) >= 2 && strings.HasPrefix(target, "/") && strings.HasSuffix(target, "/") {
+		re, err := regexp.Compile(target[1 : len(target)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid host pattern %s: %v", target, err)
+		}
+		match = func(host *sshConn.Host) bool {
+			return re.MatchString(host.Hostname) || (host.Alias != "" && re.MatchString(host.Alias))
+		}
+	} else {
+		names := make(map[string]bool)
+		for _, name := range strings.Split(target, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[name] = true
+			}
+		}
+		match = func(host *sshConn.Host) bool {
+			return names[host.Hostname] || (host.Alias != "" && names[host.Alias]) || (host.Host != "" && names[host.Host])
+		}
+	}
+
+	selected := make([]*sshConn.Host, 0, len(hosts))
+	for _, host := range hosts {
+		if match(host) {
+			selected = append(selected, host)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func targetHosts() []*sshConn.Host {
+	return []*sshConn.Host{
+		{Hostname: "web1:22", Alias: "web1", Host: "10.0.0.1"},
+		{Hostname: "web2:22", Alias: "web2", Host: "10.0.0.2"},
+		{Hostname: "web3:2222", Alias: "web3", Host: "10.0.0.3"},
+	}
+}
+
+func TestMatchHostsList(t *testing.T) {
+	got, err := matchHosts(targetHosts(), "web3, web1:22,10.0.0.9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Alias != "web1" || got[1].Alias != "web3" {
+		t.Fatalf("unexpected hosts: %#v", hostnames(got))
+	}
+}
+
+func TestMatchHostsRegex(t *testing.T) {
+	got, err := matchHosts(targetHosts(), "/^web[23]/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Alias != "web2" || got[1].Alias != "web3" {
+		t.Fatalf("unexpected hosts: %#v", hostnames(got))
+	}
+}
+
+func TestMatchHostsInvalidRegex(t *testing.T) {
+	if _, err := matchHosts(targetHosts(), "/web[/"); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+}
+
+func TestMatchHostsEmptyTarget(t *testing.T) {
+	if _, err := matchHosts(targetHosts(), " "); err == nil {
+		t.Fatal("expected error for empty target")
+	}
+}
@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+// commandField matches the host fields a command may reference, as in
+// `systemctl restart {{.Tags.role}}`. Anything else between braces, such as
+// `docker ps --format '{{.Names}}'`, is sent as typed.
+var commandField = regexp.MustCompile(`\{\{\s*\.(Hostname|Alias|User|Port|Tags\.([\w-]+))\s*\}\}`)
+
+// isCommandTemplate reports whether command references a host field. Other
+// commands are sent as typed, so shell and tool braces never need escaping.
+func isCommandTemplate(command string) bool {
+	return commandField.MatchString(command)
+}
+
+// expandCommand replaces the host fields referenced in command with host's
+// values. A tag the host does not have is an error rather than an empty
+// string.
+func expandCommand(host *sshConn.Host, command string) (string, error) {
+	if !isCommandTemplate(command) {
+		return command, nil
+	}
+	var missing string
+	expanded := commandField.ReplaceAllStringFunc(command, func(field string) string {
+		match := commandField.FindStringSubmatch(field)
+		switch match[1] {
+		case "Hostname":
+			return host.Hostname
+		case "Alias":
+			return host.Alias
+		case "User":
+			return host.User
+		case "Port":
+			return strconv.Itoa(host.Port)
+		}
+		value, ok := host.Tags[match[2]]
+		if !ok && missing == "" {
+			missing = match[2]
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("%s: no tag %q", host.Hostname, missing)
+	}
+	return expanded, nil
+}
+
+// checkCommandTemplate expands command for every host so a template that fails
+// for one of them is reported before any host runs it.
+func checkCommandTemplate(hosts []*sshConn.Host, command string) error {
+	if !isCommandTemplate(command) {
+		return nil
+	}
+	for _, host := range hosts {
+		if _, err := expandCommand(host, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/ncode/pretty/internal/sshConn"
+)
+
+func TestExpandCommand(t *testing.T) {
+	host := &sshConn.Host{Hostname: "web1:22", Alias: "web1", User: "deploy", Port: 22, Tags: map[string]string{"role": "web"}}
+	tests := map[string]string{
+		"systemctl restart {{.Tags.role}}":        "systemctl restart web",
+		"echo {{.Alias}} {{.User}}@{{.Hostname}}": "echo web1 deploy@web1:22",
+		"awk '{print $1}' /etc/hosts":             "awk '{print $1}' /etc/hosts",
+		"echo {{ .Port }}":                        "echo 22",
+	}
+	for command, want := range tests {
+		got, err := expandCommand(host, command)
+		if err != nil {
+			t.Fatalf("expandCommand(%q): unexpected error: %v", command, err)
+		}
+		if got != want {
+			t.Fatalf("expandCommand(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestExpandCommandErrors(t *testing.T) {
+	host := &sshConn.Host{Hostname: "db1:22"}
+	if _, err := expandCommand(host, "echo {{.Tags.role}}"); err == nil {
+		t.Fatal("expected missing tag error")
+	}
+}
+
+func TestExpandCommandPassesThroughToolFormats(t *testing.T) {
+	host := &sshConn.Host{Hostname: "web1:22", Tags: map[string]string{"role": "web"}}
+	commands := []string{
+		"docker ps --format '{{.Names}}'",
+		"kubectl get po -o go-template='{{range .items}}{{.metadata.name}}{{\"\\n\"}}{{end}}'",
+		"echo {{.Tags.role",
+	}
+	for _, command := range commands {
+		if err := checkCommandTemplate([]*sshConn.Host{host}, command); err != nil {
+			t.Fatalf("checkCommandTemplate(%q): unexpected error: %v", command, err)
+		}
+		got, err := expandCommand(host, command)
+		if err != nil || got != command {
+			t.Fatalf("expandCommand(%q) = %q, %v; want it unchanged", command, got, err)
+		}
+	}
+
+	got, err := expandCommand(host, "docker ps --filter label={{.Tags.role}} --format '{{.Names}}'")
+	if err != nil || got != "docker ps --filter label=web --format '{{.Names}}'" {
+		t.Fatalf("unexpected expansion %q, %v", got, err)
+	}
+}
+
+func TestCheckCommandTemplate(t *testing.T) {
+	hosts := []*sshConn.Host{
+		{Hostname: "web1:22", Tags: map[string]string{"role": "web"}},
+		{Hostname: "db1:22"},
+	}
+	if err := checkCommandTemplate(hosts, "uptime"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := checkCommandTemplate(hosts, "echo {{.Tags.role}}")
+	if err == nil || err.Error() != `db1:22: no tag "role"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
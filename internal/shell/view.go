@@ -5,7 +5,11 @@ import tea "charm.land/bubbletea/v2"
 func (m model) View() tea.View {
 	var content string
 	if !m.quit {
-		content = m.viewport.View() + "\n" + m.input.View()
+		bottom := m.input.View()
+		if m.scrollMode && !m.searching {
+			bottom = m.scrollStatus()
+		}
+		content = m.viewport.View() + "\n" + bottom
 	}
 	v := tea.NewView(content)
 	v.AltScreen = true
@@ -1,39 +1,92 @@
 package sshConn
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// sessionCloseWait bounds how long a cancelled command waits for the server to
+// confirm the session close, so an unresponsive host cannot stall the job.
+const sessionCloseWait = 5 * time.Second
+
 func RunCommand(host *Host, command string, jobID int, events chan<- OutputEvent) (int, error) {
-	connection, err := connectionFunc(host)
-	if err != nil {
-		emitSystem(events, host, fmt.Sprintf("error connection to host %s: %v", host.Hostname, err))
-		return 1, err
-	}
-	defer connection.Close()
+	return RunCommandContext(context.Background(), host, command, jobID, events)
+}
 
-	session, err := connection.NewSession()
-	if err != nil {
-		emitSystem(events, host, fmt.Sprintf("unable to open session: %v", err))
-		return 1, err
+// RunCommandContext runs command on host in a dedicated SSH session. The
+// session is opened over the host's worker connection when it is alive, and
+// over a freshly dialed connection otherwise. When ctx is done before the
+// command finishes the session is closed and ctx.Err() is returned.
+func RunCommandContext(ctx context.Context, host *Host, command string, jobID int, events chan<- OutputEvent) (int, error) {
+	session := sharedSession(host)
+	if session == nil {
+		connection, err := connectionFunc(host)
+		if err != nil {
+			emitJobSystem(events, host, jobID, fmt.Sprintf("error connection to host %s: %v", host.Hostname, err))
+			return 1, err
+		}
+		defer connection.Close()
+		stopKeepalive := startKeepalive(host, connection, events)
+		defer stopKeepalive()
+
+		session, err = connection.NewSession()
+		if err != nil {
+			emitJobSystem(events, host, jobID, fmt.Sprintf("unable to open session: %v", err))
+			return 1, err
+		}
 	}
 	defer session.Close()
 
 	stdoutWriter := NewProxyWriter(events, host, jobID)
 	stderrWriter := NewProxyWriter(events, host, jobID)
-	stderrWriter.system = true
+	stderrWriter.stream = StreamStderr
 	session.Stdout = stdoutWriter
 	session.Stderr = stderrWriter
+	setEnv(session, host.Env)
 
-	err = session.Run(command)
+	done := make(chan error, 1)
+	err := session.Start(command)
+	if err == nil {
+		go func() {
+			done <- session.Wait()
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			session.Close()
+			// Output already in flight is still copied into events until
+			// Wait returns, and callers close events once we are done.
+			select {
+			case <-done:
+			case <-time.After(sessionCloseWait):
+			}
+			return 1, ctx.Err()
+		}
+	}
 	if err == nil {
 		return 0, nil
 	}
 	if exitErr, ok := err.(*ssh.ExitError); ok {
 		return exitErr.ExitStatus(), nil
 	}
-	emitSystem(events, host, fmt.Sprintf("command failed on %s: %v", host.Hostname, err))
+	emitJobSystem(events, host, jobID, fmt.Sprintf("command failed on %s: %v", host.Hostname, err))
 	return 1, err
 }
+
+// sharedSession opens a session over host's worker connection. It returns nil
+// when there is no shared connection or it can no longer open sessions, for
+// example because it died or the server's MaxSessions is reached.
+func sharedSession(host *Host) *ssh.Session {
+	client := host.sharedClient()
+	if client == nil {
+		return nil
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil
+	}
+	return session
+}
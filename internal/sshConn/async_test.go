@@ -1,6 +1,7 @@
 package sshConn
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"errors"
@@ -8,6 +9,7 @@ import (
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -89,9 +91,12 @@ func TestRunCommandConnectionError(t *testing.T) {
 
 	select {
 	case evt := <-events:
-		if !evt.System {
+		if evt.Stream != StreamSystem {
 			t.Fatal("expected system event")
 		}
+		if evt.JobID != 1 {
+			t.Fatalf("expected the event to carry job 1, got %d", evt.JobID)
+		}
 		if !strings.Contains(evt.Line, "connect failed") {
 			t.Fatalf("expected error in event line, got %q", evt.Line)
 		}
@@ -131,7 +136,7 @@ func TestRunCommandSessionError(t *testing.T) {
 
 	select {
 	case evt := <-events:
-		if !evt.System {
+		if evt.Stream != StreamSystem {
 			t.Fatal("expected system event")
 		}
 		if !strings.Contains(evt.Line, "unable to open session") {
@@ -270,11 +275,208 @@ func TestRunCommandNonExitError(t *testing.T) {
 	found := false
 	for len(events) > 0 {
 		evt := <-events
-		if evt.System && strings.Contains(evt.Line, "command failed") {
-			found = true
+		if evt.Stream == StreamSystem && strings.Contains(evt.Line, "command failed") {
+			found = evt.JobID == 5
 		}
 	}
 	if !found {
 		t.Fatal("expected system event with 'command failed'")
 	}
 }
+
+func TestRunCommandContextTimeoutClosesSession(t *testing.T) {
+	prevConn := connectionFunc
+	t.Cleanup(func() { connectionFunc = prevConn })
+
+	handler := func(ch ssh.NewChannel) {
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				// Accept the command but never finish it.
+				req.Reply(req.Type == "exec", nil)
+			}
+		}()
+		go io.Copy(io.Discard, channel)
+	}
+
+	client := testSSHClient(t, handler)
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events := make(chan OutputEvent, 8)
+	exitCode, err := RunCommandContext(ctx, &Host{Hostname: "slow-host"}, "sleep 60", 4, events)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+}
+
+func TestRunCommandContextTimeoutWaitsForOutput(t *testing.T) {
+	prevConn := connectionFunc
+	t.Cleanup(func() { connectionFunc = prevConn })
+
+	handler := func(ch ssh.NewChannel) {
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				req.Reply(req.Type == "exec", nil)
+			}
+		}()
+		// Keep producing output until the client closes the session.
+		go func() {
+			for {
+				if _, err := channel.Write([]byte("tick\n")); err != nil {
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	client := testSSHClient(t, handler)
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events := make(chan OutputEvent)
+	received := make(chan int)
+	go func() {
+		count := 0
+		for range events {
+			count++
+		}
+		received <- count
+	}()
+	if _, err := RunCommandContext(ctx, &Host{Hostname: "chatty-host"}, "yes tick", 4, events); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	// Closing events right away, as Exec does, must not race with output
+	// still being copied; a send on the closed channel would panic.
+	close(events)
+	if count := <-received; count == 0 {
+		t.Fatal("expected output before the timeout")
+	}
+}
+
+// execHandler accepts exec requests, writes output and exits with status 0.
+func execHandler(output string) func(ch ssh.NewChannel) {
+	return func(ch ssh.NewChannel) {
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				if req.Type == "exec" {
+					req.Reply(true, nil)
+					channel.Write([]byte(output + "\n"))
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					channel.Close()
+					return
+				}
+				req.Reply(false, nil)
+			}
+		}()
+		go io.Copy(io.Discard, channel)
+	}
+}
+
+func TestRunCommandReusesSharedClient(t *testing.T) {
+	prevConn := connectionFunc
+	t.Cleanup(func() { connectionFunc = prevConn })
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		t.Fatal("expected no dial while the shared connection is alive")
+		return nil, nil
+	}
+
+	host := &Host{Hostname: "shared-host"}
+	host.setClient(testSSHClient(t, execHandler("shared")))
+
+	events := make(chan OutputEvent, 8)
+	for i := 0; i < 2; i++ {
+		exitCode, err := RunCommand(host, "echo shared", i+1, events)
+		if err != nil || exitCode != 0 {
+			t.Fatalf("unexpected result: exit=%d err=%v", exitCode, err)
+		}
+		waitForEvent(t, events, "shared")
+	}
+}
+
+func TestRunCommandRedialsWhenSharedClientIsDead(t *testing.T) {
+	prevConn := connectionFunc
+	t.Cleanup(func() { connectionFunc = prevConn })
+
+	dead := testSSHClient(t, execHandler("dead"))
+	dead.Close()
+	fresh := testSSHClient(t, execHandler("fresh"))
+	dials := 0
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		dials++
+		return fresh, nil
+	}
+
+	host := &Host{Hostname: "dead-host"}
+	host.setClient(dead)
+
+	events := make(chan OutputEvent, 8)
+	exitCode, err := RunCommand(host, "echo fresh", 1, events)
+	if err != nil || exitCode != 0 {
+		t.Fatalf("unexpected result: exit=%d err=%v", exitCode, err)
+	}
+	if dials != 1 {
+		t.Fatalf("expected one dial, got %d", dials)
+	}
+	waitForEvent(t, events, "fresh")
+}
+
+func TestRunCommandSendsEnv(t *testing.T) {
+	handler := func(ch ssh.NewChannel) {
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			env := make([]string, 0)
+			for req := range reqs {
+				switch req.Type {
+				case "env":
+					var kv struct{ Name, Value string }
+					ssh.Unmarshal(req.Payload, &kv)
+					env = append(env, kv.Name+"="+kv.Value)
+					req.Reply(true, nil)
+				case "exec":
+					req.Reply(true, nil)
+					channel.Write([]byte(strings.Join(env, " ") + "\n"))
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					channel.Close()
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+		go io.Copy(io.Discard, channel)
+	}
+
+	host := &Host{Hostname: "env-host", Env: map[string]string{"B": "2", "A": "1"}}
+	host.setClient(testSSHClient(t, handler))
+
+	events := make(chan OutputEvent, 4)
+	if exitCode, err := RunCommand(host, "env", 1, events); err != nil || exitCode != 0 {
+		t.Fatalf("unexpected result: exit=%d err=%v", exitCode, err)
+	}
+	waitForEvent(t, events, "A=1 B=2")
+}
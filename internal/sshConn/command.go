@@ -5,6 +5,9 @@ type CommandKind int
 const (
 	CommandKindRun CommandKind = iota
 	CommandKindControl
+	// CommandKindReconnect asks a host's worker to drop its session and
+	// reconnect immediately. It is delivered to disconnected hosts as well.
+	CommandKindReconnect
 )
 
 type CommandRequest struct {
@@ -12,4 +15,7 @@ type CommandRequest struct {
 	Command     string
 	Kind        CommandKind
 	ControlByte byte
+	// Hosts restricts delivery to the hosts with these Hostnames. An empty
+	// list broadcasts the request to every connected host.
+	Hosts []string
 }
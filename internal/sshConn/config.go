@@ -85,6 +85,20 @@ type ResolvedHost struct {
 	User          string
 	IdentityFiles []string
 	ProxyJump     []string
+	// ConnectTimeout, ServerAliveInterval and ServerAliveCountMax mirror the
+	// OpenSSH options of the same name. Zero means unset.
+	ConnectTimeout      time.Duration
+	ServerAliveInterval time.Duration
+	ServerAliveCountMax int
+	// KnownHosts is a known_hosts file replacing the global one; empty
+	// keeps the global one.
+	KnownHosts string
+	// PasswordAuthentication and KbdInteractiveAuthentication mirror the
+	// OpenSSH options and default to true. Password answers both methods
+	// on a jump host; empty disables them.
+	PasswordAuthentication       bool
+	KbdInteractiveAuthentication bool
+	Password                     string
 }
 
 func LoadSSHConfig(paths SSHConfigPaths) (*SSHConfigResolver, error) {
@@ -180,6 +194,30 @@ func (r *SSHConfigResolver) ResolveHost(spec HostSpec, fallbackUser string) (Res
 	if err != nil {
 		return ResolvedHost{}, err
 	}
+	if resolved.ConnectTimeout, err = r.getDuration(alias, "ConnectTimeout"); err != nil {
+		return ResolvedHost{}, err
+	}
+	if resolved.ServerAliveInterval, err = r.getDuration(alias, "ServerAliveInterval"); err != nil {
+		return ResolvedHost{}, err
+	}
+	countMax, err := r.getValue(alias, "ServerAliveCountMax")
+	if err != nil {
+		return ResolvedHost{}, err
+	}
+	if countMax != "" {
+		resolved.ServerAliveCountMax, err = strconv.Atoi(strings.TrimSpace(countMax))
+		if err != nil || resolved.ServerAliveCountMax < 0 {
+			return ResolvedHost{}, fmt.Errorf("invalid ServerAliveCountMax %q", countMax)
+		}
+	}
+
+	if resolved.PasswordAuthentication, err = r.getYesNo(alias, true, "PasswordAuthentication"); err != nil {
+		return ResolvedHost{}, err
+	}
+	if resolved.KbdInteractiveAuthentication, err = r.getYesNo(alias, true, "KbdInteractiveAuthentication", "ChallengeResponseAuthentication"); err != nil {
+		return ResolvedHost{}, err
+	}
+
 	// OpenSSH treats `ProxyJump none` as an explicit opt-out that cancels
 	// ProxyJump inherited from broader-matching blocks. Skip parsing in that
 	// case so we don't try to dial the literal host "none".
@@ -214,6 +252,40 @@ func (r *SSHConfigResolver) getValue(alias, key string) (string, error) {
 	return "", nil
 }
 
+func (r *SSHConfigResolver) getDuration(alias, key string) (time.Duration, error) {
+	value, err := r.getValue(alias, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	duration, err := ParseSSHDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return duration, nil
+}
+
+// getYesNo reads the first of keys that is set as a yes/no option, or
+// returns fallback when none is.
+func (r *SSHConfigResolver) getYesNo(alias string, fallback bool, keys ...string) (bool, error) {
+	for _, key := range keys {
+		value, err := r.getValue(alias, key)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "":
+			continue
+		case "yes":
+			return true, nil
+		case "no":
+			return false, nil
+		default:
+			return false, fmt.Errorf("invalid %s %q", key, value)
+		}
+	}
+	return fallback, nil
+}
+
 func (r *SSHConfigResolver) getAllValues(alias, key string) ([]string, error) {
 	values := []string{}
 	if r.user != nil {
@@ -291,6 +363,30 @@ func expandPath(path string) string {
 	return path
 }
 
+// ParseSSHDuration parses a time value the way OpenSSH does for options such
+// as ConnectTimeout and ServerAliveInterval: a bare number is seconds, and Go
+// duration strings like "30s" or "1m30s" are accepted as well.
+func ParseSSHDuration(value string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+	if seconds, err := strconv.Atoi(trimmed); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("duration must not be negative")
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(trimmed)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+	return duration, nil
+}
+
 // ParseProxyJump splits a ProxyJump value into individual jump hosts. Empty
 // components are dropped, and the OpenSSH "none" sentinel (which disables
 // ProxyJump) collapses the result to an empty slice so callers never try to
@@ -316,13 +412,18 @@ func ParseProxyJump(value string) []string {
 //
 // IdentityFile entries that the local process cannot use directly (missing
 // files, public-key-only files backing a hardware token such as yubikey-agent,
-// or passphrase-protected keys) are skipped so that authentication can still
-// proceed through the SSH agent. This mirrors OpenSSH's behaviour, which
-// silently tolerates these cases instead of aborting the connection.
+// or passphrase-protected keys that UnlockIdentityFiles did not unlock) are
+// skipped so that authentication can still proceed through the SSH agent.
+// This mirrors OpenSSH's behaviour, which silently tolerates these cases
+// instead of aborting the connection.
 func LoadIdentityFiles(paths []string) ([]ssh.AuthMethod, error) {
 	methods := make([]ssh.AuthMethod, 0, len(paths))
 	for _, path := range paths {
 		expanded := expandPath(path)
+		if signer, ok := unlockedSigner(expanded); ok {
+			methods = append(methods, ssh.PublicKeys(signer))
+			continue
+		}
 		key, err := os.ReadFile(expanded)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
@@ -363,6 +365,90 @@ func TestClientConfigForCombinedAuth(t *testing.T) {
 	}
 }
 
+func TestClientConfigForPasswordAuth(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	tests := []struct {
+		host ResolvedHost
+		want int
+	}{
+		{host: ResolvedHost{PasswordAuthentication: true, KbdInteractiveAuthentication: true}, want: 0},
+		{host: ResolvedHost{Password: "s3cret", PasswordAuthentication: true, KbdInteractiveAuthentication: true}, want: 2},
+		{host: ResolvedHost{Password: "s3cret", PasswordAuthentication: true}, want: 1},
+		{host: ResolvedHost{Password: "s3cret"}, want: 0},
+	}
+	for _, tt := range tests {
+		config, err := clientConfigFor(tt.host)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(config.Auth) != tt.want {
+			t.Fatalf("%+v: expected %d auth methods, got %d", tt.host, tt.want, len(config.Auth))
+		}
+	}
+}
+
+func TestAnswerWithOnlyAnswersPasswordQuestions(t *testing.T) {
+	questions := []string{"Password: ", "Verification code: ", "Username: "}
+	echos := []bool{false, false, true}
+
+	prev := KeyboardInteractivePrompt
+	t.Cleanup(func() { KeyboardInteractivePrompt = prev })
+	KeyboardInteractivePrompt = nil
+	answers, err := answerWith("web1:22", "s3cret")("", "", questions, echos)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(answers, []string{"s3cret", "", ""}) {
+		t.Fatalf("unexpected answers: %v", answers)
+	}
+
+	var asked []string
+	KeyboardInteractivePrompt = func(hostname, question string, echo bool) (string, error) {
+		asked = append(asked, fmt.Sprintf("%s %s%v", hostname, question, echo))
+		return "123456", nil
+	}
+	answers, err = answerWith("web1:22", "s3cret")("", "", questions[:2], echos[:2])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(answers, []string{"s3cret", "123456"}) {
+		t.Fatalf("unexpected answers: %v", answers)
+	}
+	if !reflect.DeepEqual(asked, []string{"web1:22 Verification code: false"}) {
+		t.Fatalf("unexpected prompts: %v", asked)
+	}
+}
+
+func TestResolveHostAuthenticationOptions(t *testing.T) {
+	cfg := "Host locked\n  PasswordAuthentication no\n  KbdInteractiveAuthentication no\n" +
+		"Host legacy\n  ChallengeResponseAuthentication no\n" +
+		"Host broken\n  PasswordAuthentication maybe\n"
+	resolver, err := LoadSSHConfig(SSHConfigPaths{User: writeTempConfig(t, cfg)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string][2]bool{
+		"web":    {true, true},
+		"locked": {false, false},
+		"legacy": {true, false},
+	}
+	for alias, want := range tests {
+		resolved, err := resolver.ResolveHost(HostSpec{Host: alias}, "deploy")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", alias, err)
+		}
+		if got := [2]bool{resolved.PasswordAuthentication, resolved.KbdInteractiveAuthentication}; got != want {
+			t.Fatalf("%s: expected password/keyboard-interactive %v, got %v", alias, want, got)
+		}
+	}
+
+	_, err = resolver.ResolveHost(HostSpec{Host: "broken"}, "deploy")
+	if err == nil || !strings.Contains(err.Error(), `invalid PasswordAuthentication "maybe"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestParseProxyJump(t *testing.T) {
 	got := ParseProxyJump("jump1,jump2")
 	want := []string{"jump1", "jump2"}
@@ -871,6 +957,61 @@ func TestGetAllValuesWithNilConfigs(t *testing.T) {
 	}
 }
 
+func TestResolveHostKeepaliveAndTimeout(t *testing.T) {
+	cfg := "Host web\n  ConnectTimeout 5\n  ServerAliveInterval 30\n  ServerAliveCountMax 4\n"
+	userCfg := writeTempConfig(t, cfg)
+	resolver, err := LoadSSHConfig(SSHConfigPaths{User: userCfg})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolved, err := resolver.ResolveHost(HostSpec{Host: "web"}, "fallback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolved.ConnectTimeout != 5*time.Second || resolved.ServerAliveInterval != 30*time.Second || resolved.ServerAliveCountMax != 4 {
+		t.Fatalf("unexpected resolved host: %+v", resolved)
+	}
+}
+
+func TestResolveHostInvalidServerAliveCountMax(t *testing.T) {
+	userCfg := writeTempConfig(t, "Host web\n  ServerAliveCountMax lots\n")
+	resolver, err := LoadSSHConfig(SSHConfigPaths{User: userCfg})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := resolver.ResolveHost(HostSpec{Host: "web"}, "fallback"); err == nil {
+		t.Fatal("expected error for invalid ServerAliveCountMax")
+	}
+}
+
+func TestParseSSHDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"15", 15 * time.Second, false},
+		{"1m30s", 90 * time.Second, false},
+		{" 2s ", 2 * time.Second, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseSSHDuration(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("expected error for %q", tc.input)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("ParseSSHDuration(%q) = %v, %v", tc.input, got, err)
+		}
+	}
+}
+
 func writeTempConfig(t *testing.T, contents string) string {
 	t.Helper()
 	path := filepath.Join(t.TempDir(), "config")
@@ -0,0 +1,137 @@
+package sshConn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// passphraseAttempts is how many times a wrong passphrase is asked again
+// before giving up, as OpenSSH does.
+const passphraseAttempts = 3
+
+// unlockedSigners caches the signers of encrypted identity files by expanded
+// path, so a passphrase is asked once per session and the key is reused by
+// every host and jump host that lists it.
+var unlockedSigners = struct {
+	sync.Mutex
+	byPath map[string]ssh.Signer
+}{byPath: map[string]ssh.Signer{}}
+
+func unlockedSigner(path string) (ssh.Signer, bool) {
+	unlockedSigners.Lock()
+	defer unlockedSigners.Unlock()
+	signer, ok := unlockedSigners.byPath[path]
+	return signer, ok
+}
+
+// UnlockIdentityFiles decrypts the passphrase-protected keys among paths with
+// the passphrases returned by passphrase, caching their signers for
+// LoadIdentityFiles. Keys that are already unlocked, or whose public half
+// (the .pub file next to them) the SSH agent holds, are not asked for. An
+// empty passphrase skips the key, leaving it to the agent.
+func UnlockIdentityFiles(paths []string, passphrase func(path string) ([]byte, error)) error {
+	var agentKeys []*agent.Key
+	agentLoaded := false
+	for _, path := range paths {
+		expanded := expandPath(path)
+		if _, ok := unlockedSigner(expanded); ok {
+			continue
+		}
+		key, err := os.ReadFile(expanded)
+		if err != nil {
+			// LoadIdentityFiles reports unreadable files when connecting.
+			continue
+		}
+		if _, err := ssh.ParsePrivateKey(key); err == nil || !isPassphraseMissing(err) {
+			continue
+		}
+		if !agentLoaded {
+			agentKeys, agentLoaded = listAgentKeys(), true
+		}
+		if agentHoldsKey(agentKeys, expanded) {
+			continue
+		}
+
+		signer, err := unlockIdentityFile(expanded, key, passphrase)
+		if err != nil {
+			return err
+		}
+		if signer == nil {
+			continue
+		}
+		unlockedSigners.Lock()
+		unlockedSigners.byPath[expanded] = signer
+		unlockedSigners.Unlock()
+	}
+	return nil
+}
+
+func unlockIdentityFile(path string, key []byte, passphrase func(path string) ([]byte, error)) (ssh.Signer, error) {
+	for attempt := 0; attempt < passphraseAttempts; attempt++ {
+		secret, err := passphrase(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, nil
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(key, secret)
+		if err == nil {
+			return signer, nil
+		}
+		if !errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, fmt.Errorf("unable to parse identity file %q: %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("incorrect passphrase for identity file %q", path)
+}
+
+func isPassphraseMissing(err error) bool {
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+// listAgentKeys returns the keys of the agent at SSH_AUTH_SOCK, or nil when
+// there is none.
+func listAgentKeys() []*agent.Key {
+	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil
+	}
+	return keys
+}
+
+// agentHoldsKey reports whether keys include the public key stored next to
+// the identity file at path.
+func agentHoldsKey(keys []*agent.Key, path string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	data, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		return false
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if bytes.Equal(key.Marshal(), pub.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package sshConn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// writeEncryptedKey writes an RSA key encrypted with passphrase plus its .pub
+// file, and clears the signer cache when the test ends.
+func writeEncryptedKey(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	t.Cleanup(func() {
+		unlockedSigners.Lock()
+		unlockedSigners.byPath = map[string]ssh.Signer{}
+		unlockedSigners.Unlock()
+	})
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("failed to encrypt key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(path, pem.EncodeToMemory(encrypted), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to build public key: %v", err)
+	}
+	if err := os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(pub), 0o644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+	return path, pub
+}
+
+func passphrases(answers ...string) (func(string) ([]byte, error), *int) {
+	calls := 0
+	return func(string) ([]byte, error) {
+		answer := answers[calls%len(answers)]
+		calls++
+		return []byte(answer), nil
+	}, &calls
+}
+
+func TestUnlockIdentityFilesCachesSigner(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	path, _ := writeEncryptedKey(t, "secret")
+
+	passphrase, calls := passphrases("wrong", "secret")
+	if err := UnlockIdentityFiles([]string{path, path}, passphrase); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected a retry after the wrong passphrase, got %d prompts", *calls)
+	}
+	if err := UnlockIdentityFiles([]string{path}, passphrase); err != nil || *calls != 2 {
+		t.Fatalf("expected cached key not to be asked for again, err=%v prompts=%d", err, *calls)
+	}
+
+	methods, err := LoadIdentityFiles([]string{path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(methods) != 1 {
+		t.Fatalf("expected the unlocked key to produce an auth method, got %d", len(methods))
+	}
+}
+
+func TestUnlockIdentityFilesEmptyPassphraseSkipsKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	path, _ := writeEncryptedKey(t, "secret")
+
+	passphrase, calls := passphrases("")
+	if err := UnlockIdentityFiles([]string{path}, passphrase); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	methods, err := LoadIdentityFiles([]string{path})
+	if err != nil || len(methods) != 0 || *calls != 1 {
+		t.Fatalf("expected skipped key, err=%v methods=%d prompts=%d", err, len(methods), *calls)
+	}
+}
+
+func TestUnlockIdentityFilesGivesUpAfterWrongPassphrases(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	path, _ := writeEncryptedKey(t, "secret")
+
+	passphrase, calls := passphrases("wrong")
+	err := UnlockIdentityFiles([]string{path}, passphrase)
+	if err == nil || !strings.Contains(err.Error(), "incorrect passphrase for identity file") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *calls != passphraseAttempts {
+		t.Fatalf("expected %d prompts, got %d", passphraseAttempts, *calls)
+	}
+}
+
+func TestUnlockIdentityFilesSkipsUnencryptedAndMissingKeys(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	passphrase, calls := passphrases("secret")
+	missing := filepath.Join(t.TempDir(), "id_missing")
+	if err := UnlockIdentityFiles([]string{writeTempKey(t), missing}, passphrase); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *calls != 0 {
+		t.Fatalf("expected no prompts, got %d", *calls)
+	}
+}
+
+func TestAgentHoldsKey(t *testing.T) {
+	path, pub := writeEncryptedKey(t, "secret")
+	if !agentHoldsKey([]*agent.Key{{Format: pub.Type(), Blob: pub.Marshal()}}, path) {
+		t.Fatal("expected agent to hold the key")
+	}
+	if agentHoldsKey(nil, path) {
+		t.Fatal("expected an empty agent not to hold the key")
+	}
+}
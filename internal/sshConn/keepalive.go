@@ -0,0 +1,82 @@
+package sshConn
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	keepaliveRequest           = "keepalive@openssh.com"
+	defaultServerAliveCountMax = 3
+)
+
+// keepaliveClient is the subset of *ssh.Client used by keepalive, so tests
+// can simulate a server that stops answering.
+type keepaliveClient interface {
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+	Close() error
+}
+
+// keepalive sends keepalive@openssh.com global requests on client every
+// host.ServerAliveInterval until stop is closed. Once ServerAliveCountMax
+// requests in a row go unanswered the connection is closed, which ends the
+// session and lets the worker mark the host disconnected and reconnect. Like
+// OpenSSH, any reply (including a refusal) counts as the server being alive.
+func keepalive(host *Host, client keepaliveClient, events chan<- OutputEvent, stop <-chan struct{}) {
+	interval := host.ServerAliveInterval
+	if interval <= 0 || client == nil {
+		return
+	}
+	countMax := host.ServerAliveCountMax
+	if countMax <= 0 {
+		countMax = defaultServerAliveCountMax
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest(keepaliveRequest, true, nil)
+			reply <- err
+		}()
+
+		select {
+		case <-stop:
+			return
+		case err := <-reply:
+			if err == nil {
+				missed = 0
+				continue
+			}
+			missed++
+		case <-time.After(interval):
+			missed++
+		}
+
+		if missed >= countMax {
+			emitSystem(events, host, fmt.Sprintf("no response from %s after %d keepalives, closing connection", host.Hostname, missed))
+			client.Close()
+			return
+		}
+	}
+}
+
+// startKeepalive runs keepalive for connection in the background and returns
+// a function that stops it.
+func startKeepalive(host *Host, connection *ssh.Client, events chan<- OutputEvent) func() {
+	stop := make(chan struct{})
+	if host.ServerAliveInterval > 0 && connection != nil {
+		go keepalive(host, connection, events, stop)
+	}
+	return func() { close(stop) }
+}
@@ -0,0 +1,118 @@
+package sshConn
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeKeepaliveClient struct {
+	requests int32
+	closed   int32
+	reply    func() error
+}
+
+func (c *fakeKeepaliveClient) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return false, nil, c.reply()
+}
+
+func (c *fakeKeepaliveClient) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func TestKeepaliveClosesAfterCountMaxFailures(t *testing.T) {
+	client := &fakeKeepaliveClient{reply: func() error { return errors.New("no reply") }}
+	host := &Host{Hostname: "host1", ServerAliveInterval: 5 * time.Millisecond, ServerAliveCountMax: 2}
+	events := make(chan OutputEvent, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		keepalive(host, client, events, stop)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keepalive did not give up")
+	}
+	if atomic.LoadInt32(&client.closed) != 1 {
+		t.Fatal("expected client to be closed")
+	}
+	if got := atomic.LoadInt32(&client.requests); got != 2 {
+		t.Fatalf("expected 2 keepalive requests, got %d", got)
+	}
+	evt := <-events
+	if evt.Stream != StreamSystem || evt.Line != "no response from host1 after 2 keepalives, closing connection" {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestKeepaliveTreatsMissingReplyAsFailure(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	client := &fakeKeepaliveClient{reply: func() error { <-block; return nil }}
+	host := &Host{Hostname: "host1", ServerAliveInterval: 5 * time.Millisecond, ServerAliveCountMax: 1}
+	events := make(chan OutputEvent, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		keepalive(host, client, events, stop)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keepalive did not give up on an unresponsive server")
+	}
+	if atomic.LoadInt32(&client.closed) != 1 {
+		t.Fatal("expected client to be closed")
+	}
+}
+
+func TestKeepaliveStopsWhileServerResponds(t *testing.T) {
+	client := &fakeKeepaliveClient{reply: func() error { return nil }}
+	host := &Host{Hostname: "host1", ServerAliveInterval: 5 * time.Millisecond, ServerAliveCountMax: 1}
+	stop := make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		keepalive(host, client, nil, stop)
+		close(done)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	close(stop)
+	<-done
+	if atomic.LoadInt32(&client.closed) != 0 {
+		t.Fatal("expected client to stay open")
+	}
+	if atomic.LoadInt32(&client.requests) == 0 {
+		t.Fatal("expected keepalive requests to be sent")
+	}
+}
+
+func TestKeepaliveDisabledWithoutInterval(t *testing.T) {
+	client := &fakeKeepaliveClient{reply: func() error { return nil }}
+	keepalive(&Host{Hostname: "host1"}, client, nil, make(chan struct{}))
+	if atomic.LoadInt32(&client.requests) != 0 {
+		t.Fatal("expected no keepalive requests")
+	}
+}
+
+func TestConnectTimeoutDefault(t *testing.T) {
+	if got := connectTimeout(0); got != defaultConnectTimeout {
+		t.Fatalf("expected default timeout, got %s", got)
+	}
+	if got := connectTimeout(3 * time.Second); got != 3*time.Second {
+		t.Fatalf("expected configured timeout, got %s", got)
+	}
+}
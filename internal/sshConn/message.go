@@ -3,7 +3,11 @@ package sshConn
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 var (
@@ -18,7 +22,7 @@ type ProxyWriter struct {
 	events chan<- OutputEvent
 	host   *Host
 	jobID  int
-	system bool
+	stream Stream
 	buf    []byte
 }
 
@@ -49,7 +53,8 @@ func (w *ProxyWriter) Write(output []byte) (int, error) {
 			JobID:    w.jobID,
 			Hostname: w.host.Hostname,
 			Line:     string(line),
-			System:   w.system,
+			Stream:   w.stream,
+			Time:     time.Now(),
 		}
 		w.buf = w.buf[idx+1:]
 	}
@@ -57,54 +62,219 @@ func (w *ProxyWriter) Write(output []byte) (int, error) {
 }
 
 func emitSystem(events chan<- OutputEvent, host *Host, line string) {
+	emitJobSystem(events, host, 0, line)
+}
+
+// emitJobSystem is emitSystem for a line about job jobID, so output logs and
+// JSON records attribute it to the job.
+func emitJobSystem(events chan<- OutputEvent, host *Host, jobID int, line string) {
 	if events == nil {
 		fmt.Println(line)
 		return
 	}
 
 	events <- OutputEvent{
+		JobID:    jobID,
 		Hostname: host.Hostname,
 		Line:     line,
-		System:   true,
+		Stream:   StreamSystem,
+		Time:     time.Now(),
 	}
 }
 
-func worker(host *Host, input <-chan CommandRequest, events chan<- OutputEvent) {
+// emitLost emits line as the Lost event for host's part in job jobID.
+func emitLost(events chan<- OutputEvent, host *Host, jobID int, line string) {
+	if events == nil {
+		fmt.Println(line)
+		return
+	}
+
+	events <- OutputEvent{
+		JobID:    jobID,
+		Hostname: host.Hostname,
+		Line:     line,
+		Stream:   StreamSystem,
+		Time:     time.Now(),
+		Lost:     true,
+	}
+}
+
+// reconnectMinBackoff and reconnectMaxBackoff bound the exponential backoff
+// used by worker between reconnection attempts. They are variables so tests
+// can shorten them.
+var (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+)
+
+// shellConn is the interactive session a worker writes commands into.
+type shellConn struct {
+	client        *ssh.Client
+	session       *ssh.Session
+	stdin         io.WriteCloser
+	done          chan error
+	stopKeepalive func()
+}
+
+func (c *shellConn) close() {
+	if c.stopKeepalive != nil {
+		c.stopKeepalive()
+		c.stopKeepalive = nil
+	}
+	if c.session != nil {
+		c.session.Close()
+	}
+	if c.client != nil {
+		c.client.Close()
+	}
+}
+
+type serveResult int
+
+const (
+	serveInputClosed serveResult = iota
+	serveSessionLost
+	serveReconnect
+)
+
+func openShell(host *Host, stdout, stderr io.Writer, events chan<- OutputEvent) (*shellConn, error) {
 	connection, err := connectionFunc(host)
 	if err != nil {
-		emitSystem(events, host, fmt.Sprintf("error connection to host %s: %v", host.Hostname, err))
-		return
-	} else {
-		atomic.StoreInt32(&host.IsConnected, 1)
+		return nil, fmt.Errorf("error connection to host %s: %w", host.Hostname, err)
+	}
+	stdin, session, err := sessionFunc(connection, host, stdout, stderr)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("unable to open session: %w", err)
 	}
+	conn := &shellConn{client: connection, session: session, stdin: stdin}
+	conn.stopKeepalive = startKeepalive(host, connection, events)
+	if session != nil {
+		conn.done = make(chan error, 1)
+		go func() {
+			conn.done <- session.Wait()
+		}()
+	}
+	return conn, nil
+}
+
+// worker keeps an interactive shell open on host and writes every request it
+// receives into it. When the session or connection terminates the host is
+// marked disconnected and worker reconnects with exponential backoff until
+// input is closed. A CommandKindReconnect request forces an immediate
+// reconnection.
+func worker(host *Host, input <-chan CommandRequest, events chan<- OutputEvent) {
 	stdoutWriter := NewProxyWriter(events, host, 0)
 	stderrWriter := NewProxyWriter(events, host, 0)
-	stderrWriter.system = true
-	stdin, session, err := sessionFunc(connection, host, stdoutWriter, stderrWriter)
-	if err != nil {
-		emitSystem(events, host, fmt.Sprintf("unable to open session: %v", err))
+	stderrWriter.stream = StreamStderr
+
+	backoff := reconnectMinBackoff
+	reconnecting := false
+	for {
+		conn, err := openShell(host, stdoutWriter, stderrWriter, events)
+		if err != nil {
+			emitSystem(events, host, fmt.Sprintf("%v, retrying in %s", err, backoff))
+			if !waitReconnect(host, input, events, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			reconnecting = true
+			continue
+		}
+		host.setClient(conn.client)
+		atomic.StoreInt32(&host.IsConnected, 1)
+		if reconnecting {
+			emitSystem(events, host, fmt.Sprintf("reconnected to %s", host.Hostname))
+		}
+		backoff = reconnectMinBackoff
+
+		result, err := serve(host, conn, input, events, stdoutWriter, stderrWriter)
+		if result == serveInputClosed {
+			conn.stopKeepalive()
+			return
+		}
 		atomic.StoreInt32(&host.IsConnected, 0)
-		return
+		atomic.StoreInt32(&host.IsWaiting, 0)
+		host.setClient(nil)
+		conn.close()
+		reconnecting = true
+		line := fmt.Sprintf("reconnecting to %s", host.Hostname)
+		if result == serveSessionLost {
+			reason := "session closed"
+			if err != nil {
+				reason = err.Error()
+			}
+			line = fmt.Sprintf("connection to %s lost: %s, reconnecting", host.Hostname, reason)
+		}
+		// The last command written may still be running; it will never
+		// print its sentinel on the new shell.
+		emitLost(events, host, stdoutWriter.jobID, line)
+		stdoutWriter.jobID = 0
+		stderrWriter.jobID = 0
 	}
-	_ = session
+}
 
-	for request := range input {
-		atomic.StoreInt32(&host.IsWaiting, 1)
-		stdoutWriter.jobID = request.JobID
-		stderrWriter.jobID = request.JobID
-		if request.Kind == CommandKindControl {
-			if request.ControlByte != 0 {
-				if _, err := stdin.Write([]byte{request.ControlByte}); err != nil {
-					emitSystem(events, host, fmt.Sprintf("unable to send control byte: %v", err))
+func serve(host *Host, conn *shellConn, input <-chan CommandRequest, events chan<- OutputEvent, stdoutWriter, stderrWriter *ProxyWriter) (serveResult, error) {
+	for {
+		select {
+		case err := <-conn.done:
+			return serveSessionLost, err
+		case request, ok := <-input:
+			if !ok {
+				return serveInputClosed, nil
+			}
+			if request.Kind == CommandKindReconnect {
+				return serveReconnect, nil
+			}
+			atomic.StoreInt32(&host.IsWaiting, 1)
+			stdoutWriter.jobID = request.JobID
+			stderrWriter.jobID = request.JobID
+			if request.Kind == CommandKindControl {
+				if request.ControlByte != 0 {
+					if _, err := conn.stdin.Write([]byte{request.ControlByte}); err != nil {
+						emitSystem(events, host, fmt.Sprintf("unable to send control byte: %v", err))
+					}
 				}
+			} else {
+				fmt.Fprintf(conn.stdin, "%s\n", request.Command)
+			}
+			atomic.StoreInt32(&host.IsWaiting, 0)
+		}
+	}
+}
+
+// waitReconnect sleeps for backoff while draining input so the broker never
+// blocks on a disconnected host. It returns early on a reconnect request and
+// returns false once input is closed.
+func waitReconnect(host *Host, input <-chan CommandRequest, events chan<- OutputEvent, backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case request, ok := <-input:
+			if !ok {
+				return false
+			}
+			if request.Kind == CommandKindReconnect {
+				return true
+			}
+			if request.Kind == CommandKindRun {
+				emitLost(events, host, request.JobID, fmt.Sprintf("%s is disconnected, dropping command", host.Hostname))
 			}
-		} else {
-			fmt.Fprintf(stdin, "%s\n", request.Command)
 		}
-		atomic.StoreInt32(&host.IsWaiting, 0)
 	}
 }
 
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > reconnectMaxBackoff {
+		return reconnectMaxBackoff
+	}
+	return backoff
+}
+
 func Broker(hostList *HostList, input <-chan CommandRequest, events chan<- OutputEvent) {
 	for _, host := range hostList.Hosts() {
 		host.Channel = make(chan CommandRequest, brokerChannelBufferSize)
@@ -112,10 +282,31 @@ func Broker(hostList *HostList, input <-chan CommandRequest, events chan<- Outpu
 	}
 
 	for request := range input {
+		targets := requestTargets(request)
 		for _, host := range hostList.Hosts() {
-			if atomic.LoadInt32(&host.IsConnected) == 1 {
-				host.Channel <- request
+			if targets != nil && !targets[host.Hostname] {
+				continue
+			}
+			if request.Kind != CommandKindReconnect && atomic.LoadInt32(&host.IsConnected) != 1 {
+				// The host may have disconnected after the job picked it;
+				// tell the job it will get no exit status from the host.
+				if request.Kind == CommandKindRun && request.JobID > 0 && targets != nil {
+					emitLost(events, host, request.JobID, fmt.Sprintf("%s is disconnected, dropping command", host.Hostname))
+				}
+				continue
 			}
+			host.Channel <- request
 		}
 	}
 }
+
+func requestTargets(request CommandRequest) map[string]bool {
+	if len(request.Hosts) == 0 {
+		return nil
+	}
+	targets := make(map[string]bool, len(request.Hosts))
+	for _, hostname := range request.Hosts {
+		targets[hostname] = true
+	}
+	return targets
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -45,7 +46,7 @@ func TestWorkerEmitsConnectionError(t *testing.T) {
 
 	select {
 	case evt := <-events:
-		if !evt.System {
+		if evt.Stream != StreamSystem {
 			t.Fatalf("expected system event")
 		}
 		if !strings.Contains(evt.Line, "dial failed") {
@@ -104,8 +105,11 @@ func TestWorkerSessionError(t *testing.T) {
 		sessionFunc = prevSess
 	})
 
+	client := testSSHClient(t, func(ch ssh.NewChannel) {
+		ch.Reject(ssh.Prohibited, "no sessions allowed")
+	})
 	connectionFunc = func(host *Host) (*ssh.Client, error) {
-		return &ssh.Client{}, nil
+		return client, nil
 	}
 	sessionFunc = func(connection *ssh.Client, host *Host, stdout, stderr io.Writer) (io.WriteCloser, *ssh.Session, error) {
 		return nil, nil, errors.New("session failed")
@@ -124,7 +128,7 @@ func TestWorkerSessionError(t *testing.T) {
 
 	select {
 	case evt := <-events:
-		if !evt.System {
+		if evt.Stream != StreamSystem {
 			t.Fatal("expected system event")
 		}
 		if !strings.Contains(evt.Line, "session failed") {
@@ -170,7 +174,7 @@ func TestWorkerControlByteWriteError(t *testing.T) {
 	for {
 		select {
 		case evt := <-events:
-			if evt.System && strings.Contains(evt.Line, "unable to send control byte") {
+			if evt.Stream == StreamSystem && strings.Contains(evt.Line, "unable to send control byte") {
 				found = true
 			}
 		default:
@@ -182,6 +186,249 @@ func TestWorkerControlByteWriteError(t *testing.T) {
 	}
 }
 
+// shellHandler accepts a session channel and its shell request. When
+// closeAfterShell is set the channel is closed right away, simulating a remote
+// session that dies; otherwise received stdin is forwarded to written.
+func shellHandler(closeAfterShell bool, written chan<- string) func(ch ssh.NewChannel) {
+	return func(ch ssh.NewChannel) {
+		channel, reqs, err := ch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				req.Reply(req.Type == "shell", nil)
+				if req.Type == "shell" && closeAfterShell {
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					channel.Close()
+				}
+			}
+		}()
+		go func() {
+			buf := make([]byte, 256)
+			for {
+				n, err := channel.Read(buf)
+				if n > 0 && written != nil {
+					written <- string(buf[:n])
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func TestWorkerReconnectsAfterSessionLoss(t *testing.T) {
+	prevConn := connectionFunc
+	prevSess := sessionFunc
+	t.Cleanup(func() {
+		connectionFunc = prevConn
+		sessionFunc = prevSess
+	})
+
+	written := make(chan string, 4)
+	clients := []*ssh.Client{
+		testSSHClient(t, shellHandler(true, nil)),
+		testSSHClient(t, shellHandler(false, written)),
+	}
+	var dials int32
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		n := atomic.AddInt32(&dials, 1)
+		if int(n) > len(clients) {
+			return nil, errors.New("no more clients")
+		}
+		return clients[n-1], nil
+	}
+	sessionFunc = Session
+
+	host := &Host{Hostname: "host1"}
+	events := make(chan OutputEvent, 8)
+	input := make(chan CommandRequest)
+	done := make(chan struct{})
+	go func() {
+		worker(host, input, events)
+		close(done)
+	}()
+
+	waitForEvent(t, events, "lost")
+	waitForEvent(t, events, "reconnected to host1")
+	if atomic.LoadInt32(&host.IsConnected) != 1 {
+		t.Fatal("expected host connected after reconnect")
+	}
+	if host.sharedClient() != clients[1] {
+		t.Fatal("expected the new connection to be shared with async jobs")
+	}
+
+	input <- CommandRequest{Kind: CommandKindRun, JobID: 1, Command: "uptime"}
+	select {
+	case got := <-written:
+		if got != "uptime\n" {
+			t.Fatalf("unexpected command on new session: %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for command on new session")
+	}
+
+	close(input)
+	<-done
+}
+
+func TestWorkerRetriesWithBackoffAndForcedReconnect(t *testing.T) {
+	prevConn := connectionFunc
+	prevSess := sessionFunc
+	prevMin := reconnectMinBackoff
+	t.Cleanup(func() {
+		connectionFunc = prevConn
+		sessionFunc = prevSess
+		reconnectMinBackoff = prevMin
+	})
+
+	reconnectMinBackoff = time.Hour
+	var dials int32
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return nil, errors.New("dial failed")
+		}
+		return &ssh.Client{}, nil
+	}
+	sessionFunc = func(connection *ssh.Client, host *Host, stdout, stderr io.Writer) (io.WriteCloser, *ssh.Session, error) {
+		return &captureWriteCloser{}, nil, nil
+	}
+
+	host := &Host{Hostname: "host1"}
+	events := make(chan OutputEvent, 8)
+	input := make(chan CommandRequest)
+	done := make(chan struct{})
+	go func() {
+		worker(host, input, events)
+		close(done)
+	}()
+
+	waitForEvent(t, events, "retrying in 1h0m0s")
+	input <- CommandRequest{Kind: CommandKindReconnect}
+	waitForEvent(t, events, "reconnected to host1")
+
+	close(input)
+	<-done
+	if atomic.LoadInt32(&dials) != 2 {
+		t.Fatalf("expected 2 dials, got %d", dials)
+	}
+}
+
+func TestWorkerReportsJobsLostOnReconnect(t *testing.T) {
+	prevConn := connectionFunc
+	prevSess := sessionFunc
+	prevMin := reconnectMinBackoff
+	t.Cleanup(func() {
+		connectionFunc = prevConn
+		sessionFunc = prevSess
+		reconnectMinBackoff = prevMin
+	})
+
+	reconnectMinBackoff = time.Hour
+	client := testSSHClient(t, shellHandler(false, nil))
+	var dials int32
+	connectionFunc = func(host *Host) (*ssh.Client, error) {
+		if atomic.AddInt32(&dials, 1) > 1 {
+			return nil, errors.New("dial failed")
+		}
+		return client, nil
+	}
+	sessionFunc = func(connection *ssh.Client, host *Host, stdout, stderr io.Writer) (io.WriteCloser, *ssh.Session, error) {
+		return &captureWriteCloser{}, nil, nil
+	}
+
+	host := &Host{Hostname: "host1"}
+	events := make(chan OutputEvent, 8)
+	input := make(chan CommandRequest)
+	done := make(chan struct{})
+	go func() {
+		worker(host, input, events)
+		close(done)
+	}()
+
+	input <- CommandRequest{Kind: CommandKindRun, JobID: 2, Command: "sleep 60"}
+	input <- CommandRequest{Kind: CommandKindReconnect}
+	evt := waitForEvent(t, events, "reconnecting to host1")
+	if !evt.Lost || evt.JobID != 2 {
+		t.Fatalf("expected job 2 to be reported lost, got %+v", evt)
+	}
+
+	// While disconnected, dropped commands are reported lost too.
+	waitForEvent(t, events, "retrying in 1h0m0s")
+	input <- CommandRequest{Kind: CommandKindRun, JobID: 3, Command: "uptime"}
+	evt = waitForEvent(t, events, "dropping command")
+	if !evt.Lost || evt.JobID != 3 {
+		t.Fatalf("expected job 3 to be reported lost, got %+v", evt)
+	}
+
+	close(input)
+	<-done
+}
+
+func TestNextBackoffCapsAtMax(t *testing.T) {
+	if got := nextBackoff(time.Second); got != 2*time.Second {
+		t.Fatalf("expected 2s, got %s", got)
+	}
+	if got := nextBackoff(reconnectMaxBackoff); got != reconnectMaxBackoff {
+		t.Fatalf("expected cap %s, got %s", reconnectMaxBackoff, got)
+	}
+}
+
+func TestBrokerDeliversReconnectToDisconnectedHosts(t *testing.T) {
+	prevWorker := workerRunner
+	t.Cleanup(func() {
+		workerRunner = prevWorker
+	})
+
+	dispatched := make(chan string, 1)
+	workerRunner = func(host *Host, input <-chan CommandRequest, events chan<- OutputEvent) {
+		for request := range input {
+			if request.Kind == CommandKindReconnect {
+				dispatched <- host.Hostname
+			}
+		}
+	}
+
+	hostList := NewHostList()
+	hostList.AddHost(&Host{Hostname: "host1", IsConnected: 0})
+
+	input := make(chan CommandRequest, 1)
+	done := make(chan struct{})
+	go func() {
+		Broker(hostList, input, nil)
+		close(done)
+	}()
+	input <- CommandRequest{Kind: CommandKindReconnect}
+	close(input)
+	<-done
+
+	select {
+	case got := <-dispatched:
+		if got != "host1" {
+			t.Fatalf("unexpected dispatch %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected reconnect to reach disconnected host")
+	}
+}
+
+func waitForEvent(t *testing.T, events <-chan OutputEvent, substr string) OutputEvent {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case evt := <-events:
+			if strings.Contains(evt.Line, substr) {
+				return evt
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for event containing %q", substr)
+		}
+	}
+}
+
 func TestBrokerDispatchesOnlyToConnectedHosts(t *testing.T) {
 	prevWorker := workerRunner
 	t.Cleanup(func() {
@@ -222,6 +469,96 @@ func TestBrokerDispatchesOnlyToConnectedHosts(t *testing.T) {
 	}
 }
 
+func TestBrokerDispatchesOnlyToTargetedHosts(t *testing.T) {
+	prevWorker := workerRunner
+	t.Cleanup(func() {
+		workerRunner = prevWorker
+	})
+
+	dispatched := make(chan string, 3)
+	workerRunner = func(host *Host, input <-chan CommandRequest, events chan<- OutputEvent) {
+		for request := range input {
+			dispatched <- host.Hostname + ":" + request.Command
+		}
+	}
+
+	hostList := NewHostList()
+	hostList.AddHost(&Host{Hostname: "host1", IsConnected: 1})
+	hostList.AddHost(&Host{Hostname: "host2", IsConnected: 1})
+	hostList.AddHost(&Host{Hostname: "host3", IsConnected: 1})
+
+	input := make(chan CommandRequest, 1)
+	done := make(chan struct{})
+	go func() {
+		Broker(hostList, input, nil)
+		close(done)
+	}()
+
+	input <- CommandRequest{Kind: CommandKindRun, JobID: 1, Command: "date", Hosts: []string{"host1", "host3"}}
+	close(input)
+	<-done
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got[<-dispatched] = true
+	}
+	if !got["host1:date"] || !got["host3:date"] {
+		t.Fatalf("unexpected dispatches: %v", got)
+	}
+	select {
+	case extra := <-dispatched:
+		t.Fatalf("unexpected extra dispatch: %s", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerReportsTargetedDisconnectedHostLost(t *testing.T) {
+	prevWorker := workerRunner
+	t.Cleanup(func() {
+		workerRunner = prevWorker
+	})
+
+	dispatched := make(chan string, 3)
+	workerRunner = func(host *Host, input <-chan CommandRequest, events chan<- OutputEvent) {
+		for request := range input {
+			dispatched <- host.Hostname + ":" + request.Command
+		}
+	}
+
+	hostList := NewHostList()
+	hostList.AddHost(&Host{Hostname: "host1", IsConnected: 1})
+	hostList.AddHost(&Host{Hostname: "host2"})
+	hostList.AddHost(&Host{Hostname: "host3"})
+
+	events := make(chan OutputEvent, 4)
+	input := make(chan CommandRequest, 2)
+	done := make(chan struct{})
+	go func() {
+		Broker(hostList, input, events)
+		close(done)
+	}()
+
+	input <- CommandRequest{Kind: CommandKindRun, JobID: 7, Command: "date", Hosts: []string{"host1", "host2"}}
+	input <- CommandRequest{Kind: CommandKindRun, Command: "uptime"}
+	close(input)
+	<-done
+
+	if got := <-dispatched; got != "host1:date" {
+		t.Fatalf("unexpected dispatch: %s", got)
+	}
+	select {
+	case evt := <-events:
+		if !evt.Lost || evt.JobID != 7 || evt.Hostname != "host2" {
+			t.Fatalf("expected job 7 to lose host2, got %+v", evt)
+		}
+	default:
+		t.Fatal("expected a lost event for the disconnected host")
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected untargeted hosts not to be reported, got %+v", <-events)
+	}
+}
+
 func BenchmarkBrokerDispatch(b *testing.B) {
 	for _, mode := range []struct {
 		name   string
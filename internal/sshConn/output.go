@@ -1,8 +1,57 @@
 package sshConn
 
+import (
+	"fmt"
+	"time"
+)
+
+// Stream identifies where the line of an OutputEvent came from.
+type Stream int
+
+const (
+	// StreamStdout is output the remote command wrote to stdout.
+	StreamStdout Stream = iota
+	// StreamStderr is output the remote command wrote to stderr.
+	StreamStderr
+	// StreamSystem is a message from pretty itself, such as a connection
+	// error.
+	StreamSystem
+)
+
+var streamNames = map[Stream]string{
+	StreamStdout: "stdout",
+	StreamStderr: "stderr",
+	StreamSystem: "system",
+}
+
+func (s Stream) String() string {
+	if name, ok := streamNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("stream(%d)", int(s))
+}
+
+// ParseStream returns the stream called name.
+func ParseStream(name string) (Stream, error) {
+	for stream, streamName := range streamNames {
+		if streamName == name {
+			return stream, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stream %q", name)
+}
+
 type OutputEvent struct {
 	JobID    int
 	Hostname string
 	Line     string
-	System   bool
+	Stream   Stream
+	// Time is when the line was produced, before it waited in the events
+	// channel.
+	Time time.Time
+
+	// Lost marks the system event sent when host's interactive shell goes
+	// away or a command for it is dropped, so job JobID will never get an
+	// exit status from host.
+	Lost bool
 }
@@ -5,23 +5,40 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProxyWriterEmitsLines(t *testing.T) {
 	events := make(chan OutputEvent, 1)
 	host := &Host{Hostname: "host1"}
 	w := NewProxyWriter(events, host, 99)
+	before := time.Now()
 	_, _ = w.Write([]byte("hello\n"))
 	select {
 	case evt := <-events:
 		if evt.Hostname != "host1" || evt.JobID != 99 || evt.Line != "hello" {
 			t.Fatalf("unexpected event: %+v", evt)
 		}
+		if evt.Time.Before(before) || evt.Time.After(time.Now()) {
+			t.Fatalf("expected the event stamped when written, got %v", evt.Time)
+		}
 	default:
 		t.Fatalf("expected output event")
 	}
 }
 
+func TestParseStream(t *testing.T) {
+	for _, stream := range []Stream{StreamStdout, StreamStderr, StreamSystem} {
+		got, err := ParseStream(stream.String())
+		if err != nil || got != stream {
+			t.Fatalf("ParseStream(%q) = %v, %v", stream.String(), got, err)
+		}
+	}
+	if _, err := ParseStream("stdin"); err == nil || err.Error() != `unknown stream "stdin"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestProxyWriterBuffersPartialLine(t *testing.T) {
 	events := make(chan OutputEvent, 2)
 	host := &Host{Hostname: "host1"}
@@ -83,7 +100,7 @@ func TestEmitSystemSendsEventWhenChannelExists(t *testing.T) {
 
 	select {
 	case evt := <-events:
-		if !evt.System {
+		if evt.Stream != StreamSystem {
 			t.Fatalf("expected system event")
 		}
 		if evt.Hostname != "host1" || evt.Line != "failed" {
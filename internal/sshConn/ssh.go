@@ -8,7 +8,9 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -66,10 +68,74 @@ type Host struct {
 	User          string
 	IdentityFiles []string
 	ProxyJump     []ResolvedHost
+	Groups        []string
 	IsConnected   int32
 	Channel       chan CommandRequest
 	ControlC      chan os.Signal
 	IsWaiting     int32
+
+	// ConnectTimeout bounds the TCP connect and SSH handshake; zero uses
+	// defaultConnectTimeout. ServerAliveInterval enables keepalives and
+	// ServerAliveCountMax is how many may go unanswered before the
+	// connection is considered dead.
+	ConnectTimeout      time.Duration
+	ServerAliveInterval time.Duration
+	ServerAliveCountMax int
+
+	// KnownHosts replaces the `known_hosts` config key for this host and its
+	// jump hosts. Env is sent to every session with setenv requests, which
+	// the server only honors for names it lists in AcceptEnv.
+	KnownHosts string
+	Env        map[string]string
+
+	// Tags are the key=value pairs attached to the host in a hosts file.
+	Tags map[string]string
+
+	// Password answers password and keyboard-interactive authentication,
+	// which PasswordAuth and KbdInteractiveAuth allow as SSH config does.
+	// Neither method is offered without a password.
+	Password           string
+	PasswordAuth       bool
+	KbdInteractiveAuth bool
+
+	// client is the connection held by the host's worker, shared with async
+	// jobs so they open sessions instead of redialing.
+	client atomic.Pointer[ssh.Client]
+}
+
+// HasTag reports whether h matches a tag selector: `key=value` needs that
+// exact value and a bare `key` any value.
+func (h *Host) HasTag(selector string) bool {
+	return MatchTag(h.Tags, selector)
+}
+
+// MatchTag reports whether tags match a `key=value` or bare `key` selector.
+func MatchTag(tags map[string]string, selector string) bool {
+	key, value, hasValue := strings.Cut(selector, "=")
+	got, ok := tags[strings.TrimSpace(key)]
+	if !ok {
+		return false
+	}
+	return !hasValue || got == strings.TrimSpace(value)
+}
+
+// setClient records the worker's live connection; nil clears it.
+func (h *Host) setClient(client *ssh.Client) {
+	h.client.Store(client)
+}
+
+// sharedClient returns the worker's live connection, or nil when there is none.
+func (h *Host) sharedClient() *ssh.Client {
+	return h.client.Load()
+}
+
+const defaultConnectTimeout = 10 * time.Second
+
+func connectTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultConnectTimeout
+	}
+	return timeout
 }
 
 func Agent() ssh.AuthMethod {
@@ -92,6 +158,20 @@ func PublicKeyFile(privateKey string) ssh.AuthMethod {
 	return ssh.PublicKeys(signer)
 }
 
+// knownHostsCallback verifies host keys against path, or falls back to
+// hostKeyCallback when path is empty. Unlike the global file, a per-host file
+// that cannot be loaded is an error.
+func knownHostsCallback(path string) (ssh.HostKeyCallback, error) {
+	if path == "" {
+		return hostKeyCallback(), nil
+	}
+	callback, err := knownhosts.New(expandPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load known_hosts %q: %w", path, err)
+	}
+	return callback, nil
+}
+
 func hostKeyCallback() ssh.HostKeyCallback {
 	if path := viper.GetString("known_hosts"); path != "" {
 		if callback, err := knownhosts.New(path); err == nil {
@@ -115,33 +195,96 @@ func resolvedAddress(host ResolvedHost) string {
 	return net.JoinHostPort(host.Host, strconv.Itoa(host.Port))
 }
 
-func Connection(host *Host) (connection *ssh.Client, err error) {
-	authMethods := make([]ssh.AuthMethod, 0, 2)
+// authMethods lists the methods offered to a server in OpenSSH's default
+// order: agent and identity file keys, then keyboard-interactive and password
+// when a password is known and SSH config allows them.
+func authMethods(hostname string, identityFiles []string, password string, passwordAuth, kbdInteractiveAuth bool) ([]ssh.AuthMethod, error) {
+	methods := make([]ssh.AuthMethod, 0, 4)
 	if agent := Agent(); agent != nil {
-		authMethods = append(authMethods, agent)
+		methods = append(methods, agent)
 	}
-	if len(host.IdentityFiles) > 0 {
-		fileMethods, err := LoadIdentityFiles(host.IdentityFiles)
+	if len(identityFiles) > 0 {
+		fileMethods, err := LoadIdentityFiles(identityFiles)
 		if err != nil {
 			return nil, err
 		}
-		authMethods = append(authMethods, fileMethods...)
+		methods = append(methods, fileMethods...)
+	}
+	if password == "" {
+		return methods, nil
+	}
+	if kbdInteractiveAuth {
+		methods = append(methods, ssh.KeyboardInteractive(answerWith(hostname, password)))
+	}
+	if passwordAuth {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods, nil
+}
+
+// KeyboardInteractivePrompt asks the user a keyboard-interactive question that
+// is not a password prompt, such as the verification code of an OTP
+// appliance. Without it such questions get an empty answer, so the server
+// rejects the method and password authentication is tried next.
+var KeyboardInteractivePrompt func(hostname, question string, echo bool) (string, error)
+
+// answerWith answers keyboard-interactive password prompts, like the usual
+// single "Password:" of PAM, with password and asks KeyboardInteractivePrompt
+// for anything else.
+func answerWith(hostname, password string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			echo := i < len(echos) && echos[i]
+			if isPasswordQuestion(question, echo) {
+				answers[i] = password
+				continue
+			}
+			if KeyboardInteractivePrompt == nil {
+				continue
+			}
+			answer, err := KeyboardInteractivePrompt(hostname, question, echo)
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	}
+}
+
+// isPasswordQuestion reports whether a keyboard-interactive question asks for
+// the account password rather than, say, a one-time code.
+func isPasswordQuestion(question string, echo bool) bool {
+	return !echo && strings.Contains(strings.ToLower(question), "password")
+}
+
+func Connection(host *Host) (connection *ssh.Client, err error) {
+	authMethods, err := authMethods(host.Hostname, host.IdentityFiles, host.Password, host.PasswordAuth, host.KbdInteractiveAuth)
+	if err != nil {
+		return nil, err
 	}
 
+	callback, err := knownHostsCallback(host.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
 	sshConfig := &ssh.ClientConfig{
 		User:            host.User,
 		Auth:            authMethods,
-		HostKeyCallback: hostKeyCallback(),
-		Timeout:         10 * time.Second,
+		HostKeyCallback: callback,
+		Timeout:         connectTimeout(host.ConnectTimeout),
 	}
 
 	if len(host.ProxyJump) > 0 {
 		target := ResolvedHost{
-			Alias:         host.Alias,
-			Host:          host.Host,
-			Port:          host.Port,
-			User:          host.User,
-			IdentityFiles: host.IdentityFiles,
+			Alias:          host.Alias,
+			Host:           host.Host,
+			Port:           host.Port,
+			User:           host.User,
+			IdentityFiles:  host.IdentityFiles,
+			ConnectTimeout: host.ConnectTimeout,
+			KnownHosts:     host.KnownHosts,
 		}
 		configs := map[string]*ssh.ClientConfig{
 			host.Alias: sshConfig,
@@ -169,23 +312,20 @@ func Connection(host *Host) (connection *ssh.Client, err error) {
 }
 
 func clientConfigFor(host ResolvedHost) (*ssh.ClientConfig, error) {
-	authMethods := make([]ssh.AuthMethod, 0, 2)
-	if agent := Agent(); agent != nil {
-		authMethods = append(authMethods, agent)
-	}
-	if len(host.IdentityFiles) > 0 {
-		fileMethods, err := LoadIdentityFiles(host.IdentityFiles)
-		if err != nil {
-			return nil, err
-		}
-		authMethods = append(authMethods, fileMethods...)
+	authMethods, err := authMethods(host.Alias, host.IdentityFiles, host.Password, host.PasswordAuthentication, host.KbdInteractiveAuthentication)
+	if err != nil {
+		return nil, err
 	}
 
+	callback, err := knownHostsCallback(host.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
 	return &ssh.ClientConfig{
 		User:            host.User,
 		Auth:            authMethods,
-		HostKeyCallback: hostKeyCallback(),
-		Timeout:         10 * time.Second,
+		HostKeyCallback: callback,
+		Timeout:         connectTimeout(host.ConnectTimeout),
 	}, nil
 }
 
@@ -230,6 +370,7 @@ func Session(connection *ssh.Client, host *Host, stdout, stderr io.Writer) (stdi
 
 	session.Stdout = stdout
 	session.Stderr = stderr
+	setEnv(session, host.Env)
 	stdin, err = session.StdinPipe()
 	if err != nil {
 		return stdin, session, err
@@ -242,3 +383,17 @@ func Session(connection *ssh.Client, host *Host, stdout, stderr io.Writer) (stdi
 
 	return stdin, session, err
 }
+
+// setEnv asks the server to set env for session in a stable order. Servers
+// refuse names missing from their AcceptEnv, which, as with OpenSSH, is not
+// treated as an error.
+func setEnv(session *ssh.Session, env map[string]string) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_ = session.Setenv(name, env[name])
+	}
+}
@@ -40,6 +40,23 @@ func TestHostKeyCallbackWithViperKnownHosts(t *testing.T) {
 	}
 }
 
+func TestKnownHostsCallbackPerHost(t *testing.T) {
+	dir := t.TempDir()
+	khPath := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(khPath, []byte{}, 0o600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+	if cb, err := knownHostsCallback(khPath); err != nil || cb == nil {
+		t.Fatalf("expected callback for %s, got %v", khPath, err)
+	}
+	if _, err := knownHostsCallback(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected error for missing per-host known_hosts")
+	}
+	if cb, err := knownHostsCallback(""); err != nil || cb == nil {
+		t.Fatalf("expected global callback for empty path, got %v", err)
+	}
+}
+
 func TestHostKeyCallbackFallbackInsecure(t *testing.T) {
 	viper.Set("known_hosts", "")
 
@@ -109,3 +126,24 @@ func TestHostListLifecycleAndState(t *testing.T) {
 		t.Fatalf("expected connected=2 waiting=1, got connected=%d waiting=%d", connected, waiting)
 	}
 }
+
+func TestHostHasTag(t *testing.T) {
+	host := &Host{Tags: map[string]string{"role": "web", "az": ""}}
+	tests := map[string]bool{
+		"role=web":   true,
+		"role = web": true,
+		"role=db":    false,
+		"role":       true,
+		"az":         true,
+		"az=":        true,
+		"rack":       false,
+	}
+	for selector, want := range tests {
+		if got := host.HasTag(selector); got != want {
+			t.Fatalf("HasTag(%q) = %v, want %v", selector, got, want)
+		}
+	}
+	if (&Host{}).HasTag("role") {
+		t.Fatal("expected host without tags not to match")
+	}
+}